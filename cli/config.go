@@ -4,32 +4,92 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"config_handler/presets"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// SymlinkRule applies a symlink policy (link, follow or skip) to matching paths
+type SymlinkRule struct {
+	Pattern string `mapstructure:"pattern" yaml:"pattern"`
+	Policy  string `mapstructure:"policy" yaml:"policy"`
+}
+
+// Root is a further directory synced next to the config directory, stored in
+// its own directory of the repository with its own patterns
+type Root struct {
+	Source  string   `mapstructure:"source" yaml:"source"`
+	Target  string   `mapstructure:"target" yaml:"target"`
+	Include []string `mapstructure:"include" yaml:"include"`
+	Exclude []string `mapstructure:"exclude" yaml:"exclude"`
+}
+
+// Repository modes: copy keeps copies of the files in the repository, in-place
+// tracks them in the config directory with the git directory in repo_dir
+const (
+	ModeCopy    = "copy"
+	ModeInPlace = "in-place"
+)
+
 // AppConfig holds the application configuration
 type AppConfig struct {
 	// Paths
 	ConfigDir  string `mapstructure:"config_dir"`
 	RepoDir    string `mapstructure:"repo_dir"`
+	RepoPrefix string `mapstructure:"repo_prefix"`
 	ConfigFile string `mapstructure:"config_file"`
+	StateFile  string `mapstructure:"state_file"`
+	Mode       string `mapstructure:"mode"`
 
 	// Sync settings
-	SyncInterval time.Duration `mapstructure:"sync_interval"`
+	MaintenanceInterval time.Duration `mapstructure:"maintenance_interval"`
+	QuietPeriod         time.Duration `mapstructure:"quiet_period"`
+	MaxLatency          time.Duration `mapstructure:"max_latency"`
+	StormThreshold      int           `mapstructure:"storm_threshold"`
+	StormWindow         time.Duration `mapstructure:"storm_window"`
+	RescanInterval      time.Duration `mapstructure:"rescan_interval"`
+	WatcherBackend      string        `mapstructure:"watcher_backend"`
+	PollInterval        time.Duration `mapstructure:"poll_interval"`
+	ShutdownTimeout     time.Duration `mapstructure:"shutdown_timeout"`
+	MaxDeletePercent    int           `mapstructure:"max_delete_percent"`
+	TrashGracePeriod    time.Duration `mapstructure:"trash_grace_period"`
+	PreserveXattrs      bool          `mapstructure:"preserve_xattrs"`
+	RecordOwnership     bool          `mapstructure:"manifest_ownership"`
 
 	// Include/Exclude patterns
 	IncludePatterns []string `mapstructure:"include"`
 	ExcludePatterns []string `mapstructure:"exclude"`
 
+	// Application presets, expanded into include/exclude patterns
+	Presets       []string         `mapstructure:"presets"`
+	CustomPresets []presets.Preset `mapstructure:"custom_presets"`
+
+	// Further source roots, such as the home directory
+	Roots []Root `mapstructure:"roots"`
+
+	// Symlink handling
+	SymlinkPolicy string        `mapstructure:"symlink_policy"`
+	SymlinkRules  []SymlinkRule `mapstructure:"symlinks"`
+
 	// Operation modes
 	RunOnce  bool `mapstructure:"run_once"`
 	SyncOnly bool `mapstructure:"sync_only"`
 	Verbose  bool `mapstructure:"verbose"`
+
+	// Args holds the command and its arguments given after the flags
+	Args []string `mapstructure:"-"`
+
+	// legacySyncInterval records that the retired sync_interval setting was given
+	legacySyncInterval bool
 }
 
+// commandLineConfig holds the defaults and flag values, before the config file is applied
+var commandLineConfig AppConfig
+
 // ParseFlags parses command-line flags and loads configuration from file
 func ParseFlags() (*AppConfig, error) {
 	// Set up configuration defaults
@@ -45,16 +105,38 @@ func ParseFlags() (*AppConfig, error) {
 	defaultConfigDir := filepath.Join(homeDir, ".config")
 	defaultRepoDir := filepath.Join(homeDir, ".config_sync_repo")
 	defaultConfigFile := filepath.Join("config.yml")
+	defaultStateFile := filepath.Join(homeDir, ".config_handler", "state.json")
 
 	// Set up command line flags
 	pflag.StringVar(&config.ConfigDir, "config-dir", defaultConfigDir, "Directory containing configuration files to sync")
 	pflag.StringVar(&config.RepoDir, "repo-dir", defaultRepoDir, "Directory for the git repository")
+	pflag.StringVar(&config.RepoPrefix, "repo-prefix", "", "Directory of the repository the config directory is stored in (empty for the top level)")
 	pflag.StringVarP(&config.ConfigFile, "config-file", "c", defaultConfigFile, "Configuration file path")
+	pflag.StringVar(&config.StateFile, "state-file", defaultStateFile, "File storing the trash and other runtime state")
+	pflag.StringVar(&config.Mode, "mode", ModeCopy, "Repository mode: copy files into repo-dir, or in-place to keep only the git directory there")
+
+	pflag.DurationVar(&config.MaintenanceInterval, "maintenance-interval", 5*time.Second, "Interval between trash cleanups, retries of paused syncs and status updates")
+	pflag.DurationP("sync-interval", "i", 0, "Retired; changes are synced after the quiet period")
+	pflag.CommandLine.MarkDeprecated("sync-interval", "changes are synced once they settle, see --quiet-period and --max-latency; use --maintenance-interval for the interval of trash cleanups and retries")
+	pflag.DurationVar(&config.QuietPeriod, "quiet-period", time.Second, "How long a file must go without changes before it is synced")
+	pflag.DurationVar(&config.MaxLatency, "max-latency", 30*time.Second, "Longest a change waits for its file to settle before it is synced anyway")
+	pflag.IntVar(&config.StormThreshold, "storm-threshold", 200, "Number of changes within the storm window that are committed as one burst (0 disables)")
+	pflag.DurationVar(&config.StormWindow, "storm-window", 10*time.Second, "Sliding window over which changes are counted for storm detection")
+	pflag.DurationVar(&config.RescanInterval, "rescan-interval", 10*time.Minute, "Interval between full comparisons of the config directory with the repository (0 disables)")
+	pflag.StringVar(&config.WatcherBackend, "watcher-backend", "auto", "How changes are detected: fsnotify, poll, or auto to poll where fsnotify can't be used")
+	pflag.DurationVar(&config.PollInterval, "poll-interval", 5*time.Second, "Interval between scans of the config directory with the poll backend")
+	pflag.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "How long to wait for pending changes to be committed and pushed on exit")
+	pflag.IntVar(&config.MaxDeletePercent, "max-delete-percent", 50, "Pause syncing when a batch would delete more than this percentage of tracked files (0 disables)")
+	pflag.DurationVar(&config.TrashGracePeriod, "trash-grace-period", time.Hour, "How long deleted files stay in the trash before the deletion is committed (0 disables)")
+
+	pflag.BoolVar(&config.PreserveXattrs, "preserve-xattrs", false, "Copy extended attributes along with file contents")
+	pflag.BoolVar(&config.RecordOwnership, "manifest-ownership", false, "Record file owner and group in the permission manifest")
 
-	pflag.DurationVarP(&config.SyncInterval, "sync-interval", "i", 5*time.Second, "Interval between checking for changes")
+	pflag.StringVar(&config.SymlinkPolicy, "symlink-policy", "follow", "Default handling of symbolic links: link, follow or skip")
 
 	pflag.StringSliceVar(&config.IncludePatterns, "include", []string{}, "Directories/files to include (comma-separated)")
 	pflag.StringSliceVar(&config.ExcludePatterns, "exclude", []string{}, "Directories/files to exclude (comma-separated)")
+	pflag.StringSliceVar(&config.Presets, "preset", []string{}, "Application presets to sync (comma-separated)")
 
 	pflag.BoolVar(&config.RunOnce, "run-once", false, "Sync once and exit")
 	pflag.BoolVar(&config.SyncOnly, "sync-only", false, "Only perform sync without starting watcher")
@@ -62,17 +144,89 @@ func ParseFlags() (*AppConfig, error) {
 
 	// Parse the flags
 	pflag.Parse()
+	config.Args = pflag.Args()
+	config.legacySyncInterval = pflag.CommandLine.Changed("sync-interval")
 
+	// Remember the defaults and flags so reloads start from the same base
+	commandLineConfig = *config
+
+	if err := loadConfigFile(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Patterns returns the include and exclude patterns with the presets expanded
+func (c *AppConfig) Patterns() ([]string, []string, error) {
+	include, exclude, err := presets.NewCatalog(c.CustomPresets).Expand(c.Presets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	include = append(append([]string{}, c.IncludePatterns...), include...)
+	exclude = append(append([]string{}, c.ExcludePatterns...), exclude...)
+	return include, exclude, nil
+}
+
+// InPlace reports whether the config directory is tracked in place
+func (c *AppConfig) InPlace() bool {
+	return c.Mode == ModeInPlace
+}
+
+// SourceRoots returns the config directory, stored in RepoPrefix with the
+// presets expanded, followed by the further roots with a leading ~ expanded
+func (c *AppConfig) SourceRoots() ([]Root, error) {
+	include, exclude, err := c.Patterns()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := []Root{{Source: c.ConfigDir, Target: c.RepoPrefix, Include: include, Exclude: exclude}}
+	for _, root := range c.Roots {
+		root.Source = expandHome(root.Source)
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
+
+// ReloadConfig reads the config file again. Settings given as flags keep
+// precedence over the file, as they do at startup.
+func ReloadConfig() (*AppConfig, error) {
+	config := commandLineConfig
+	if err := loadConfigFile(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// loadConfigFile applies the settings of the config file that weren't given as flags
+func loadConfigFile(config *AppConfig) error {
 	// Create a new Viper instance to avoid duplicated keys
 	v := viper.New()
 	v.SetConfigFile(config.ConfigFile)
 
+	// It's okay if config file doesn't exist
+	if _, err := os.Stat(config.ConfigFile); os.IsNotExist(err) {
+		return nil
+	}
+
 	// Try to read configuration file
 	if err := v.ReadInConfig(); err != nil {
-		// It's okay if config file doesn't exist
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("error reading config file: %w", err)
-		}
+		return fmt.Errorf("error reading config file: %w", err)
 	}
 
 	// Use flag values if they were set, otherwise use values from config file
@@ -84,8 +238,73 @@ func ParseFlags() (*AppConfig, error) {
 		config.RepoDir = v.GetString("repo_dir")
 	}
 
-	if v.IsSet("sync_interval") && !pflag.CommandLine.Changed("sync-interval") {
-		config.SyncInterval = v.GetDuration("sync_interval")
+	if v.IsSet("repo_prefix") && !pflag.CommandLine.Changed("repo-prefix") {
+		config.RepoPrefix = v.GetString("repo_prefix")
+	}
+
+	if v.IsSet("state_file") && !pflag.CommandLine.Changed("state-file") {
+		config.StateFile = v.GetString("state_file")
+	}
+
+	if v.IsSet("mode") && !pflag.CommandLine.Changed("mode") {
+		config.Mode = v.GetString("mode")
+	}
+
+	if v.IsSet("maintenance_interval") && !pflag.CommandLine.Changed("maintenance-interval") {
+		config.MaintenanceInterval = v.GetDuration("maintenance_interval")
+	}
+
+	// The old key is kept out of the settings so validate can warn about it
+	if v.IsSet("sync_interval") {
+		config.legacySyncInterval = true
+	}
+
+	if v.IsSet("quiet_period") && !pflag.CommandLine.Changed("quiet-period") {
+		config.QuietPeriod = v.GetDuration("quiet_period")
+	}
+
+	if v.IsSet("max_latency") && !pflag.CommandLine.Changed("max-latency") {
+		config.MaxLatency = v.GetDuration("max_latency")
+	}
+
+	if v.IsSet("storm_threshold") && !pflag.CommandLine.Changed("storm-threshold") {
+		config.StormThreshold = v.GetInt("storm_threshold")
+	}
+
+	if v.IsSet("storm_window") && !pflag.CommandLine.Changed("storm-window") {
+		config.StormWindow = v.GetDuration("storm_window")
+	}
+
+	if v.IsSet("rescan_interval") && !pflag.CommandLine.Changed("rescan-interval") {
+		config.RescanInterval = v.GetDuration("rescan_interval")
+	}
+
+	if v.IsSet("watcher_backend") && !pflag.CommandLine.Changed("watcher-backend") {
+		config.WatcherBackend = v.GetString("watcher_backend")
+	}
+
+	if v.IsSet("poll_interval") && !pflag.CommandLine.Changed("poll-interval") {
+		config.PollInterval = v.GetDuration("poll_interval")
+	}
+
+	if v.IsSet("shutdown_timeout") && !pflag.CommandLine.Changed("shutdown-timeout") {
+		config.ShutdownTimeout = v.GetDuration("shutdown_timeout")
+	}
+
+	if v.IsSet("max_delete_percent") && !pflag.CommandLine.Changed("max-delete-percent") {
+		config.MaxDeletePercent = v.GetInt("max_delete_percent")
+	}
+
+	if v.IsSet("trash_grace_period") && !pflag.CommandLine.Changed("trash-grace-period") {
+		config.TrashGracePeriod = v.GetDuration("trash_grace_period")
+	}
+
+	if v.IsSet("preserve_xattrs") && !pflag.CommandLine.Changed("preserve-xattrs") {
+		config.PreserveXattrs = v.GetBool("preserve_xattrs")
+	}
+
+	if v.IsSet("manifest_ownership") && !pflag.CommandLine.Changed("manifest-ownership") {
+		config.RecordOwnership = v.GetBool("manifest_ownership")
 	}
 
 	if v.IsSet("include") && !pflag.CommandLine.Changed("include") {
@@ -96,6 +315,32 @@ func ParseFlags() (*AppConfig, error) {
 		config.ExcludePatterns = v.GetStringSlice("exclude")
 	}
 
+	if v.IsSet("presets") && !pflag.CommandLine.Changed("preset") {
+		config.Presets = v.GetStringSlice("presets")
+	}
+
+	if v.IsSet("custom_presets") {
+		if err := v.UnmarshalKey("custom_presets", &config.CustomPresets); err != nil {
+			return fmt.Errorf("error reading custom presets: %w", err)
+		}
+	}
+
+	if v.IsSet("roots") {
+		if err := v.UnmarshalKey("roots", &config.Roots); err != nil {
+			return fmt.Errorf("error reading roots: %w", err)
+		}
+	}
+
+	if v.IsSet("symlink_policy") && !pflag.CommandLine.Changed("symlink-policy") {
+		config.SymlinkPolicy = v.GetString("symlink_policy")
+	}
+
+	if v.IsSet("symlinks") {
+		if err := v.UnmarshalKey("symlinks", &config.SymlinkRules); err != nil {
+			return fmt.Errorf("error reading symlink rules: %w", err)
+		}
+	}
+
 	if v.IsSet("run_once") && !pflag.CommandLine.Changed("run-once") {
 		config.RunOnce = v.GetBool("run_once")
 	}
@@ -108,7 +353,7 @@ func ParseFlags() (*AppConfig, error) {
 		config.Verbose = v.GetBool("verbose")
 	}
 
-	return config, nil
+	return nil
 }
 
 // SaveConfig saves the configuration to a file
@@ -121,9 +366,29 @@ func SaveConfig(config *AppConfig) error {
 	// to prevent duplicate keys in the config file
 	v.Set("config_dir", config.ConfigDir)
 	v.Set("repo_dir", config.RepoDir)
-	v.Set("sync_interval", config.SyncInterval)
+	v.Set("repo_prefix", config.RepoPrefix)
+	v.Set("state_file", config.StateFile)
+	v.Set("mode", config.Mode)
+	v.Set("maintenance_interval", config.MaintenanceInterval)
+	v.Set("quiet_period", config.QuietPeriod)
+	v.Set("max_latency", config.MaxLatency)
+	v.Set("storm_threshold", config.StormThreshold)
+	v.Set("storm_window", config.StormWindow)
+	v.Set("rescan_interval", config.RescanInterval)
+	v.Set("watcher_backend", config.WatcherBackend)
+	v.Set("poll_interval", config.PollInterval)
+	v.Set("shutdown_timeout", config.ShutdownTimeout)
+	v.Set("max_delete_percent", config.MaxDeletePercent)
+	v.Set("trash_grace_period", config.TrashGracePeriod)
+	v.Set("preserve_xattrs", config.PreserveXattrs)
+	v.Set("manifest_ownership", config.RecordOwnership)
 	v.Set("include", config.IncludePatterns)
 	v.Set("exclude", config.ExcludePatterns)
+	v.Set("presets", config.Presets)
+	v.Set("custom_presets", config.CustomPresets)
+	v.Set("roots", config.Roots)
+	v.Set("symlink_policy", config.SymlinkPolicy)
+	v.Set("symlinks", config.SymlinkRules)
 	v.Set("run_once", config.RunOnce)
 	v.Set("sync_only", config.SyncOnly)
 	v.Set("verbose", config.Verbose)
@@ -141,3 +406,44 @@ func SaveConfig(config *AppConfig) error {
 
 	return nil
 }
+
+// SavePatterns updates the presets and the include and exclude patterns in
+// the config file, leaving its other settings as they are. A missing file is
+// created with the full configuration.
+func SavePatterns(config *AppConfig) error {
+	return updateConfigFile(config, map[string]any{
+		"presets": config.Presets,
+		"include": config.IncludePatterns,
+		"exclude": config.ExcludePatterns,
+	})
+}
+
+// SaveRepoPrefix updates the repository prefix in the config file, leaving
+// its other settings as they are
+func SaveRepoPrefix(config *AppConfig) error {
+	return updateConfigFile(config, map[string]any{"repo_prefix": config.RepoPrefix})
+}
+
+// updateConfigFile sets the given keys in the config file, or writes the full
+// configuration if the file doesn't exist yet
+func updateConfigFile(config *AppConfig, values map[string]any) error {
+	if _, err := os.Stat(config.ConfigFile); os.IsNotExist(err) {
+		return SaveConfig(config)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(config.ConfigFile)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	for key, value := range values {
+		v.Set(key, value)
+	}
+
+	if err := v.WriteConfigAs(config.ConfigFile); err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+
+	return nil
+}
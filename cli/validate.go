@@ -0,0 +1,310 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/gobwas/glob"
+)
+
+// Problem is a mistake found in the configuration
+type Problem struct {
+	Setting string
+	Message string
+	// Warning marks problems that don't stop the config handler from starting
+	Warning bool
+}
+
+// String formats the problem for display
+func (p Problem) String() string {
+	return p.Setting + ": " + p.Message
+}
+
+// HasErrors reports whether any of the problems is more than a warning
+func HasErrors(problems []Problem) bool {
+	for _, problem := range problems {
+		if !problem.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the configuration for patterns that don't compile,
+// directories that are missing or nested in each other, paths that can't be
+// written and settings that are out of range
+func Validate(config *AppConfig) []Problem {
+	var problems []Problem
+
+	include, exclude, err := config.Patterns()
+	if err != nil {
+		problems = append(problems, Problem{Setting: "presets", Message: err.Error()})
+	}
+
+	for _, pattern := range include {
+		if _, err := glob.Compile(pattern); err != nil {
+			problems = append(problems, Problem{Setting: "include", Message: fmt.Sprintf("invalid pattern %q: %v", pattern, err)})
+		}
+	}
+
+	for _, pattern := range exclude {
+		if _, err := glob.Compile(pattern); err != nil {
+			problems = append(problems, Problem{Setting: "exclude", Message: fmt.Sprintf("invalid pattern %q: %v", pattern, err)})
+		}
+	}
+
+	for _, rule := range config.SymlinkRules {
+		if _, err := glob.Compile(rule.Pattern); err != nil {
+			problems = append(problems, Problem{Setting: "symlinks", Message: fmt.Sprintf("invalid pattern %q: %v", rule.Pattern, err)})
+		}
+	}
+
+	if info, err := os.Stat(config.ConfigDir); err != nil {
+		problems = append(problems, Problem{Setting: "config_dir", Message: fmt.Sprintf("%s is not accessible: %v", config.ConfigDir, err)})
+	} else if !info.IsDir() {
+		problems = append(problems, Problem{Setting: "config_dir", Message: config.ConfigDir + " is not a directory"})
+	}
+
+	if info, err := os.Stat(config.RepoDir); err == nil && !info.IsDir() {
+		problems = append(problems, Problem{Setting: "repo_dir", Message: config.RepoDir + " is not a directory"})
+	}
+
+	configDir, repoDir := absPath(config.ConfigDir), absPath(config.RepoDir)
+	switch {
+	case configDir == repoDir:
+		problems = append(problems, Problem{Setting: "repo_dir", Message: "the repository and config directory are the same directory"})
+	case isInside(repoDir, configDir):
+		problems = append(problems, Problem{Setting: "repo_dir", Message: fmt.Sprintf("%s is inside the config directory, so the repository would sync itself", config.RepoDir)})
+	case isInside(configDir, repoDir):
+		problems = append(problems, Problem{Setting: "config_dir", Message: fmt.Sprintf("%s is inside the repository directory", config.ConfigDir)})
+	}
+
+	problems = append(problems, validateRoots(config)...)
+
+	switch config.Mode {
+	case ModeCopy:
+	case ModeInPlace:
+		// The work tree is the config directory, so there is nothing else to store
+		if config.RepoPrefix != "" {
+			problems = append(problems, Problem{Setting: "repo_prefix", Message: "can't be used in in-place mode"})
+		}
+		if len(config.Roots) > 0 {
+			problems = append(problems, Problem{Setting: "roots", Message: "can't be used in in-place mode"})
+		}
+	default:
+		problems = append(problems, Problem{Setting: "mode", Message: fmt.Sprintf("must be %s or %s, got %q", ModeCopy, ModeInPlace, config.Mode)})
+	}
+
+	if err := checkWritable(config.RepoDir); err != nil {
+		problems = append(problems, Problem{Setting: "repo_dir", Message: err.Error()})
+	}
+
+	if err := checkWritable(filepath.Dir(config.StateFile)); err != nil {
+		problems = append(problems, Problem{Setting: "state_file", Message: err.Error()})
+	}
+
+	if config.MaintenanceInterval <= 0 {
+		problems = append(problems, Problem{Setting: "maintenance_interval", Message: fmt.Sprintf("must be positive, got %s", config.MaintenanceInterval)})
+	}
+
+	if config.legacySyncInterval {
+		problems = append(problems, Problem{Setting: "sync_interval", Message: "is no longer used: changes are synced once they settle (quiet_period, max_latency); set maintenance_interval for the interval of trash cleanups and retries", Warning: true})
+	}
+
+	if config.QuietPeriod <= 0 {
+		problems = append(problems, Problem{Setting: "quiet_period", Message: fmt.Sprintf("must be positive, got %s", config.QuietPeriod)})
+	}
+
+	if config.MaxLatency < config.QuietPeriod {
+		problems = append(problems, Problem{Setting: "max_latency", Message: fmt.Sprintf("must be at least the quiet period (%s), got %s", config.QuietPeriod, config.MaxLatency)})
+	}
+
+	if config.StormThreshold < 0 {
+		problems = append(problems, Problem{Setting: "storm_threshold", Message: fmt.Sprintf("must not be negative, got %d", config.StormThreshold)})
+	}
+
+	if config.StormWindow <= 0 {
+		problems = append(problems, Problem{Setting: "storm_window", Message: fmt.Sprintf("must be positive, got %s", config.StormWindow)})
+	}
+
+	if config.RescanInterval < 0 {
+		problems = append(problems, Problem{Setting: "rescan_interval", Message: fmt.Sprintf("must not be negative, got %s", config.RescanInterval)})
+	}
+
+	switch config.WatcherBackend {
+	case "auto", "fsnotify", "poll":
+	default:
+		problems = append(problems, Problem{Setting: "watcher_backend", Message: fmt.Sprintf("must be auto, fsnotify or poll, got %q", config.WatcherBackend)})
+	}
+
+	if config.PollInterval <= 0 {
+		problems = append(problems, Problem{Setting: "poll_interval", Message: fmt.Sprintf("must be positive, got %s", config.PollInterval)})
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		problems = append(problems, Problem{Setting: "shutdown_timeout", Message: fmt.Sprintf("must be positive, got %s", config.ShutdownTimeout)})
+	}
+
+	if config.MaxDeletePercent < 0 || config.MaxDeletePercent > 100 {
+		problems = append(problems, Problem{Setting: "max_delete_percent", Message: fmt.Sprintf("must be between 0 and 100, got %d", config.MaxDeletePercent)})
+	}
+
+	if config.TrashGracePeriod < 0 {
+		problems = append(problems, Problem{Setting: "trash_grace_period", Message: fmt.Sprintf("must not be negative, got %s", config.TrashGracePeriod)})
+	}
+
+	return problems
+}
+
+// validateRoots checks repo_prefix and the further source roots. A root may contain the
+// repository or another root, which it then leaves alone, but two roots can't
+// share a source or a repository directory.
+func validateRoots(config *AppConfig) []Problem {
+	var problems []Problem
+
+	repoDir := absPath(config.RepoDir)
+	sources := map[string]string{absPath(config.ConfigDir): "config_dir"}
+	targets := make(map[string]string)
+
+	if config.RepoPrefix != "" {
+		prefix := filepath.Clean(filepath.FromSlash(config.RepoPrefix))
+		if message := checkTarget(prefix); message != "" {
+			problems = append(problems, Problem{Setting: "repo_prefix", Message: fmt.Sprintf("%q %s", config.RepoPrefix, message)})
+		} else if prefix != "." {
+			targets[prefix] = "repo_prefix"
+		}
+	}
+
+	for i, root := range config.Roots {
+		setting := fmt.Sprintf("roots[%d]", i)
+		source := expandHome(root.Source)
+
+		if root.Source == "" {
+			problems = append(problems, Problem{Setting: setting, Message: "source is not set"})
+		} else if info, err := os.Stat(source); err != nil {
+			problems = append(problems, Problem{Setting: setting, Message: fmt.Sprintf("%s is not accessible: %v", root.Source, err)})
+		} else if !info.IsDir() {
+			problems = append(problems, Problem{Setting: setting, Message: root.Source + " is not a directory"})
+		} else {
+			abs := absPath(source)
+			switch {
+			case sources[abs] != "":
+				problems = append(problems, Problem{Setting: setting, Message: fmt.Sprintf("%s is already synced by %s", root.Source, sources[abs])})
+			case abs == repoDir || isInside(abs, repoDir):
+				problems = append(problems, Problem{Setting: setting, Message: fmt.Sprintf("%s is inside the repository directory", root.Source)})
+			}
+			sources[abs] = setting
+		}
+
+		target := filepath.Clean(filepath.FromSlash(root.Target))
+		switch message := checkTarget(target); {
+		case root.Target == "" || target == ".":
+			problems = append(problems, Problem{Setting: setting, Message: "target must name a directory of the repository"})
+		case message != "":
+			problems = append(problems, Problem{Setting: setting, Message: fmt.Sprintf("target %q %s", root.Target, message)})
+		case targets[target] != "":
+			problems = append(problems, Problem{Setting: setting, Message: fmt.Sprintf("target %q is already used by %s", root.Target, targets[target])})
+		default:
+			targets[target] = setting
+		}
+
+		for _, pattern := range root.Include {
+			if _, err := glob.Compile(pattern); err != nil {
+				problems = append(problems, Problem{Setting: setting + ".include", Message: fmt.Sprintf("invalid pattern %q: %v", pattern, err)})
+			}
+		}
+
+		for _, pattern := range root.Exclude {
+			if _, err := glob.Compile(pattern); err != nil {
+				problems = append(problems, Problem{Setting: setting + ".exclude", Message: fmt.Sprintf("invalid pattern %q: %v", pattern, err)})
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkTarget describes what is wrong with a directory of the repository
+// given in the configuration, or returns "" if it is fine
+func checkTarget(target string) string {
+	switch {
+	case filepath.IsAbs(target) || target == ".." || strings.HasPrefix(target, ".."+string(filepath.Separator)):
+		return "must be a relative path inside the repository"
+	case slices.Contains(strings.Split(filepath.ToSlash(target), "/"), ".git"):
+		return "is inside git metadata"
+	}
+	return ""
+}
+
+// absPath returns a cleaned absolute path with symbolic links resolved where possible
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return filepath.Clean(path)
+}
+
+// isInside reports whether path is below dir
+func isInside(path, dir string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// ValidateRemote checks the repository URL. Any URL go-git can use is
+// accepted; remotes the HTTP token doesn't apply to, such as SSH ones, are
+// reported as warnings.
+func ValidateRemote(remoteURL string) []Problem {
+	endpoint, err := transport.NewEndpoint(remoteURL)
+	if err != nil {
+		return []Problem{{Setting: "remote", Message: fmt.Sprintf("malformed remote URL %q: %v", remoteURL, err)}}
+	}
+
+	switch endpoint.Protocol {
+	case "https", "http":
+		if endpoint.Host == "" || strings.Trim(endpoint.Path, "/") == "" {
+			return []Problem{{Setting: "remote", Message: fmt.Sprintf("remote URL %q must name a host and a repository path", remoteURL)}}
+		}
+		return nil
+	default:
+		return []Problem{{
+			Setting: "remote",
+			Message: fmt.Sprintf("remote URL %q uses %s, so the GitHub token is not used for it", remoteURL, endpoint.Protocol),
+			Warning: true,
+		}}
+	}
+}
+
+// checkWritable checks that a directory, or the closest existing parent it
+// would be created in, accepts new files
+func checkWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("%s does not exist", dir)
+		}
+		dir = parent
+	}
+
+	file, err := os.CreateTemp(dir, ".config_handler-write-test-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	return nil
+}
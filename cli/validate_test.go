@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// validConfig returns a configuration Validate finds nothing wrong with
+func validConfig(t *testing.T) AppConfig {
+	t.Helper()
+
+	dir := t.TempDir()
+	configDir := filepath.Join(dir, "config")
+	if err := os.Mkdir(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return AppConfig{
+		ConfigDir:           configDir,
+		RepoDir:             filepath.Join(dir, "repo"),
+		StateFile:           filepath.Join(dir, "state", "state.json"),
+		Mode:                ModeCopy,
+		MaintenanceInterval: 5 * time.Second,
+		QuietPeriod:         time.Second,
+		MaxLatency:          30 * time.Second,
+		StormThreshold:      200,
+		StormWindow:         10 * time.Second,
+		RescanInterval:      10 * time.Minute,
+		WatcherBackend:      "auto",
+		PollInterval:        5 * time.Second,
+		ShutdownTimeout:     30 * time.Second,
+		MaxDeletePercent:    50,
+		TrashGracePeriod:    time.Hour,
+	}
+}
+
+// problemSettings returns the settings of the problems, marking warnings with a "?"
+func problemSettings(problems []Problem) []string {
+	settings := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		setting := problem.Setting
+		if problem.Warning {
+			setting += "?"
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *AppConfig)
+		want   []string
+	}{
+		{"valid", func(c *AppConfig) {}, []string{}},
+		{"invalid include", func(c *AppConfig) { c.IncludePatterns = []string{"nvim/[init"} }, []string{"include"}},
+		{"invalid exclude", func(c *AppConfig) { c.ExcludePatterns = []string{"cache/[a-"} }, []string{"exclude"}},
+		{"missing config dir", func(c *AppConfig) { c.ConfigDir += "-missing" }, []string{"config_dir"}},
+		{"repository inside the config dir", func(c *AppConfig) { c.RepoDir = filepath.Join(c.ConfigDir, "repo") }, []string{"repo_dir"}},
+		{"same directories", func(c *AppConfig) { c.RepoDir = c.ConfigDir }, []string{"repo_dir"}},
+		{"unknown mode", func(c *AppConfig) { c.Mode = "mirror" }, []string{"mode"}},
+		{"prefix in place", func(c *AppConfig) { c.Mode, c.RepoPrefix = ModeInPlace, "config" }, []string{"repo_prefix"}},
+		{"prefix outside the repository", func(c *AppConfig) { c.RepoPrefix = "../config" }, []string{"repo_prefix"}},
+		{"zero maintenance interval", func(c *AppConfig) { c.MaintenanceInterval = 0 }, []string{"maintenance_interval"}},
+		{"retired sync interval", func(c *AppConfig) { c.legacySyncInterval = true }, []string{"sync_interval?"}},
+		{"latency below the quiet period", func(c *AppConfig) { c.MaxLatency = c.QuietPeriod / 2 }, []string{"max_latency"}},
+		{"negative storm threshold", func(c *AppConfig) { c.StormThreshold = -1 }, []string{"storm_threshold"}},
+		{"unknown backend", func(c *AppConfig) { c.WatcherBackend = "inotify" }, []string{"watcher_backend"}},
+		{"delete percent above 100", func(c *AppConfig) { c.MaxDeletePercent = 101 }, []string{"max_delete_percent"}},
+		{"negative grace period", func(c *AppConfig) { c.TrashGracePeriod = -time.Minute }, []string{"trash_grace_period"}},
+		{"root without source", func(c *AppConfig) { c.Roots = []Root{{Target: "home"}} }, []string{"roots[0]"}},
+		{"root sharing the config dir", func(c *AppConfig) { c.Roots = []Root{{Source: c.ConfigDir, Target: "home"}} }, []string{"roots[0]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t)
+			tt.modify(&config)
+
+			if got := problemSettings(Validate(&config)); !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() problems = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRemote(t *testing.T) {
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://github.com/user/dotfiles.git", []string{}},
+		{"http://git.example.com/user/dotfiles", []string{}},
+		{"https://github.com", []string{"remote"}},
+		{"https:///user/dotfiles.git", []string{"remote"}},
+		{"git@github.com:user/dotfiles.git", []string{"remote?"}},
+		{"ssh://git@github.com/user/dotfiles.git", []string{"remote?"}},
+		{"file:///srv/git/dotfiles.git", []string{"remote?"}},
+		{"https://github.com/user/%zz", []string{"remote"}},
+	}
+
+	for _, tt := range tests {
+		if got := problemSettings(ValidateRemote(tt.url)); !slices.Equal(got, tt.want) {
+			t.Errorf("ValidateRemote(%q) problems = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"config_handler/cli"
+	"config_handler/config"
+	"config_handler/git"
+	"config_handler/presets"
+	"config_handler/ui"
+)
+
+// runCommand runs the command given after the flags and returns the exit status
+func runCommand(appConfig *cli.AppConfig) int {
+	command, args := appConfig.Args[0], appConfig.Args[1:]
+
+	switch command {
+	case "trash":
+		return runTrashCommand(appConfig, args)
+	case "restore":
+		return runRestoreCommand(appConfig, args)
+	case "discover":
+		return runDiscoverCommand(appConfig)
+	case "explain":
+		return runExplainCommand(appConfig, args)
+	case "validate":
+		return runValidateCommand(appConfig)
+	case "migrate":
+		return runMigrateCommand(appConfig, args)
+	case "presets":
+		return runPresetsCommand(appConfig)
+	case "track":
+		return runTrackCommand(appConfig, args)
+	case "untrack":
+		return runUntrackCommand(appConfig, args)
+	case "tracked":
+		return runTrackedCommand(appConfig)
+	case "status":
+		return runStatusCommand(appConfig)
+	case "resume":
+		return runResumeCommand(appConfig)
+	default:
+		ui.PrintError("Unknown command: " + command)
+		printCommandUsage()
+		return 1
+	}
+}
+
+// printCommandUsage lists the available commands
+func printCommandUsage() {
+	ui.PrintInfo("Available commands:")
+	ui.PrintInfo("  discover               Scan the config directory and choose what to sync")
+	ui.PrintInfo("  explain <path...>      Show which rule includes or excludes a path")
+	ui.PrintInfo("  migrate <prefix>       Move the config directory's files to another directory of the repository")
+	ui.PrintInfo("  presets                List the application presets")
+	ui.PrintInfo("  restore [path...]      Restore files from the repository with their recorded permissions")
+	ui.PrintInfo("  resume                 Sync the changes a running instance held back after a failed safety check")
+	ui.PrintInfo("  status                 Show how the config directory is watched and the inotify watch budget")
+	ui.PrintInfo("  track <path...>        Start syncing a path and add it to the include patterns")
+	ui.PrintInfo("  tracked                List the patterns and the files in the repository")
+	ui.PrintInfo("  trash list             List deleted files waiting in the trash")
+	ui.PrintInfo("  trash restore <path>   Restore a trashed file or directory into the config directory")
+	ui.PrintInfo("  untrack <path...>      Stop syncing a path and remove it from the repository (keeps the local file)")
+	ui.PrintInfo("  validate               Check the configuration and report problems")
+}
+
+// runTrashCommand lists or restores files waiting in the trash
+func runTrashCommand(appConfig *cli.AppConfig, args []string) int {
+	configManagers, err := newConfigManagers(appConfig, nil, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	if len(args) == 0 || args[0] == "list" {
+		empty := true
+		for _, configManager := range configManagers {
+			items, err := configManager.TrashEntries()
+			if err != nil {
+				ui.PrintError("Failed to read trash: " + err.Error())
+				return 1
+			}
+
+			if len(items) > 0 && empty {
+				ui.PrintSection("Trash")
+				empty = false
+			}
+			for _, item := range items {
+				ui.PrintFileOperation("trashed", fmt.Sprintf("%s (deleted %s, removed after %s)",
+					commandPath(configManagers, configManager, item.Path), item.DeletedAt.Format(time.DateTime), item.ExpiresAt.Format(time.DateTime)))
+			}
+		}
+
+		if empty {
+			ui.PrintInfo("The trash is empty")
+		}
+		return 0
+	}
+
+	if args[0] != "restore" || len(args) < 2 {
+		ui.PrintError("Usage: trash list | trash restore <path>")
+		return 1
+	}
+
+	exitCode := 0
+	for _, path := range args[1:] {
+		configManager, relPath := managerForPath(appConfig, configManagers, path)
+		restored, err := configManager.RestoreFromTrash(relPath)
+		for _, relPath := range restored {
+			ui.PrintFileOperation("added", relPath)
+		}
+		if err != nil {
+			ui.PrintError("Failed to restore " + path + ": " + err.Error())
+			exitCode = 1
+			continue
+		}
+		ui.PrintSuccess(fmt.Sprintf("Restored %d files from the trash", len(restored)))
+	}
+
+	return exitCode
+}
+
+// runRestoreCommand copies files from the repository back into the config
+// directory, re-applying the permissions recorded in the manifest
+func runRestoreCommand(appConfig *cli.AppConfig, args []string) int {
+	// In-place mode restores from the last commit, so it needs the repository
+	var gitRepo *git.GitRepo
+	if appConfig.InPlace() {
+		var err error
+		if gitRepo, err = initRepository(appConfig); err != nil {
+			ui.PrintError("Failed to open repository: " + err.Error())
+			return 1
+		}
+	}
+
+	configManagers, err := newConfigManagers(appConfig, gitRepo, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	// Without paths every root is restored
+	paths := args
+	if len(paths) == 0 {
+		for _, configManager := range configManagers {
+			paths = append(paths, configManager.ConfigDir)
+		}
+	}
+
+	exitCode := 0
+	for _, path := range paths {
+		configManager, relPath := managerForPath(appConfig, configManagers, path)
+
+		summary, err := configManager.Restore(relPath, false)
+		if err == nil && len(summary.Conflicts) > 0 {
+			ui.PrintWarning(fmt.Sprintf("%d files differ from the repository:", len(summary.Conflicts)))
+			for _, conflict := range summary.Conflicts {
+				ui.PrintFileOperation("modified", conflict)
+			}
+
+			if ui.PromptYesNo("Overwrite them with the repository version?", false) {
+				for _, conflict := range summary.Conflicts {
+					overwritten, overwriteErr := configManager.Restore(conflict, true)
+					if overwriteErr != nil {
+						err = overwriteErr
+						break
+					}
+					summary.Restored = append(summary.Restored, overwritten.Restored...)
+					summary.Warnings = append(summary.Warnings, overwritten.Warnings...)
+				}
+			}
+		}
+
+		if summary != nil {
+			for _, restored := range summary.Restored {
+				ui.PrintFileOperation("added", restored)
+			}
+			for _, warning := range summary.Warnings {
+				ui.PrintWarning(warning)
+			}
+		}
+
+		if err != nil {
+			ui.PrintError("Failed to restore " + path + ": " + err.Error())
+			exitCode = 1
+			continue
+		}
+
+		ui.PrintSuccess(fmt.Sprintf("Restored %d files (%d already up to date)", len(summary.Restored), len(summary.Unchanged)))
+	}
+
+	return exitCode
+}
+
+// runExplainCommand shows which rule includes or excludes each path
+func runExplainCommand(appConfig *cli.AppConfig, args []string) int {
+	if len(args) == 0 {
+		ui.PrintError("Usage: explain <path...>")
+		return 1
+	}
+
+	configManagers, err := newConfigManagers(appConfig, nil, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	for _, path := range args {
+		configManager, relPath := managerForPath(appConfig, configManagers, path)
+		decision := configManager.Explain(relPath)
+		relPath = commandPath(configManagers, configManager, relPath)
+
+		switch {
+		case decision.Included:
+			ui.PrintFileOperation("added", fmt.Sprintf("%s: included, %s", relPath, decision.Reason))
+		case decision.Descend:
+			ui.PrintFileOperation("modified", fmt.Sprintf("%s: walked but not synced itself, %s", relPath, decision.Reason))
+		default:
+			ui.PrintFileOperation("deleted", fmt.Sprintf("%s: excluded, %s", relPath, decision.Reason))
+		}
+	}
+
+	return 0
+}
+
+// runPresetsCommand lists the built-in and custom presets with their patterns
+func runPresetsCommand(appConfig *cli.AppConfig) int {
+	catalog := presets.NewCatalog(appConfig.CustomPresets)
+
+	ui.PrintSection("Presets")
+	for _, preset := range catalog.All() {
+		marker := " "
+		if slices.Contains(appConfig.Presets, preset.Name) {
+			marker = "*"
+		}
+
+		ui.PrintInfo(fmt.Sprintf("%s %-10s %s", marker, preset.Name, preset.Description))
+		if appConfig.Verbose {
+			if len(preset.Include) > 0 {
+				ui.PrintFileOperation("added", strings.Join(preset.Include, ", "))
+			}
+			if len(preset.Exclude) > 0 {
+				ui.PrintFileOperation("deleted", strings.Join(preset.Exclude, ", "))
+			}
+		}
+	}
+
+	return 0
+}
+
+// managerForPath returns the manager of the innermost root holding a path
+// given on the command line, with the path relative to that root. Relative
+// paths belong to the config directory.
+func managerForPath(appConfig *cli.AppConfig, configManagers []*config.Manager, path string) (*config.Manager, string) {
+	if filepath.IsAbs(path) {
+		var found *config.Manager
+		var foundRel string
+		for _, configManager := range configManagers {
+			relPath, err := filepath.Rel(configManager.ConfigDir, path)
+			if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if found == nil || len(configManager.ConfigDir) > len(found.ConfigDir) {
+				found, foundRel = configManager, relPath
+			}
+		}
+		if found != nil {
+			return found, foundRel
+		}
+	}
+
+	return configManagers[0], configRelPath(appConfig, path)
+}
+
+// commandPath shows a path of a root the way it would be given on the
+// command line: relative for the config directory, absolute for other roots
+func commandPath(configManagers []*config.Manager, configManager *config.Manager, relPath string) string {
+	if configManager == configManagers[0] {
+		return relPath
+	}
+	return filepath.Join(configManager.ConfigDir, relPath)
+}
+
+// configRelPath converts a path given on the command line into a path relative
+// to the config directory
+func configRelPath(appConfig *cli.AppConfig, path string) string {
+	if filepath.IsAbs(path) {
+		if relPath, err := filepath.Rel(appConfig.ConfigDir, path); err == nil {
+			return relPath
+		}
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"config_handler/state"
+	"config_handler/ui"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchReservePercent is the share of the inotify watch limit left to other
+// programs, such as editors and file managers, which stop noticing changes
+// once the limit is reached
+const watchReservePercent = 10
+
+// watchDir is a directory the watcher needs
+type watchDir struct {
+	relPath string
+	path    string
+}
+
+// watchPlan lists the directories to watch, most important first: the config
+// directory itself, then directories the include patterns match, then the
+// directories walked because they may contain included paths. Shallower
+// directories come first within each group, since they are where new
+// directories appear.
+func (m *Manager) watchPlan() ([]watchDir, error) {
+	var included, descended []watchDir
+	err := m.walkConfig(m.ConfigDir, nil, func(relPath, path string, info os.FileInfo) error {
+		if !info.IsDir() {
+			return nil
+		}
+		decision := m.decide(relPath, true)
+		switch {
+		case decision.Included:
+			included = append(included, watchDir{relPath, path})
+		case decision.Descend:
+			descended = append(descended, watchDir{relPath, path})
+		default:
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dirs := range [][]watchDir{included, descended} {
+		sort.SliceStable(dirs, func(i, j int) bool {
+			return strings.Count(dirs[i].relPath, string(filepath.Separator)) < strings.Count(dirs[j].relPath, string(filepath.Separator))
+		})
+	}
+
+	plan := []watchDir{{".", m.ConfigDir}}
+	plan = append(plan, included...)
+	return append(plan, descended...), nil
+}
+
+// DirsToWatch counts the directories the watcher needs for this root
+func (m *Manager) DirsToWatch() (int, error) {
+	plan, err := m.watchPlan()
+	return len(plan), err
+}
+
+// InotifyWatches returns the user's inotify watch limit and how many watches
+// their processes hold; ok is false where this isn't known
+func InotifyWatches() (limit, inUse int, ok bool) {
+	if limit, ok = inotifyLimit(); !ok {
+		return 0, 0, false
+	}
+	inUse, ok = inotifyWatchesInUse()
+	return limit, inUse, ok
+}
+
+// InotifyReserve is how many of limit watches are left to other programs
+func InotifyReserve(limit int) int {
+	return limit * watchReservePercent / 100
+}
+
+// inotifyBudget returns how many inotify watches may still be added, or -1
+// if the limit is unknown
+func inotifyBudget() (budget, limit int) {
+	limit, inUse, ok := InotifyWatches()
+	if !ok {
+		return -1, 0
+	}
+	return max(limit-InotifyReserve(limit)-inUse, 0), limit
+}
+
+// recordWatcherStatus stores how the root is watched for the status command,
+// skipping the write when nothing changed since the last call
+func (m *Manager) recordWatcherStatus() {
+	if m.State == nil || m.FileWatcher == nil {
+		return
+	}
+
+	watched, polled := m.FileWatcher.Usage()
+	if watched == m.recordedUsage[0] && polled == m.recordedUsage[1] && !m.recordedAt.IsZero() {
+		return
+	}
+	m.recordedUsage, m.recordedAt = [2]int{watched, polled}, time.Now()
+
+	err := m.State.SetWatcherStatus(state.WatcherStatus{
+		Root:      m.ConfigDir,
+		PID:       os.Getpid(),
+		Backend:   m.FileWatcher.Name(),
+		Watched:   watched,
+		Polled:    polled,
+		UpdatedAt: m.recordedAt,
+	})
+	if err != nil && m.Verbose {
+		ui.PrintWarning("Failed to record the watcher status: " + err.Error())
+	}
+}
+
+// WatcherStatus returns how a running instance last reported watching this
+// root, or nil if none did
+func (m *Manager) WatcherStatus() (*state.WatcherStatus, error) {
+	if m.State == nil {
+		return nil, nil
+	}
+
+	statuses, err := m.State.WatcherStatuses()
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if status.Root == m.ConfigDir {
+			return &status, nil
+		}
+	}
+	return nil, nil
+}
+
+// budgetWatcher watches directories with inotify while its budget of watches
+// lasts and polls the rest. Directories are given a watch in the order they
+// are added, so the most important ones should come first.
+type budgetWatcher struct {
+	native  *fsnotifyWatcher
+	polling *pollingWatcher
+	events  chan fsnotify.Event
+	errors  chan error
+	done    chan struct{}
+	close   sync.Once
+
+	mu      sync.Mutex
+	budget  int // -1 when unlimited
+	watched map[string]bool
+}
+
+// newBudgetWatcher creates a watcher that uses at most budget inotify watches
+func newBudgetWatcher(budget int, interval time.Duration) (*budgetWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &budgetWatcher{
+		native:  &fsnotifyWatcher{watcher},
+		polling: newPollingWatcher(interval),
+		events:  make(chan fsnotify.Event),
+		errors:  make(chan error),
+		done:    make(chan struct{}),
+		budget:  budget,
+		watched: make(map[string]bool),
+	}
+
+	var forwarding sync.WaitGroup
+	forwarding.Add(2)
+	go b.forward(b.native, &forwarding)
+	go b.forward(b.polling, &forwarding)
+	go func() {
+		forwarding.Wait()
+		close(b.events)
+		close(b.errors)
+	}()
+
+	return b, nil
+}
+
+// forward passes the events and errors of one backend on
+func (b *budgetWatcher) forward(w Watcher, forwarding *sync.WaitGroup) {
+	defer forwarding.Done()
+
+	events, errs := w.Events(), w.Errors()
+	for events != nil || errs != nil {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			select {
+			case b.events <- event:
+			case <-b.done:
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			select {
+			case b.errors <- err:
+			case <-b.done:
+			}
+		}
+	}
+}
+
+// Add watches a directory with inotify if the budget allows, and polls it
+// otherwise. Running out of watches early, because other programs took them,
+// shrinks the budget to what was actually available.
+func (b *budgetWatcher) Add(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.watched[path] || b.budget < 0 || len(b.watched) < b.budget {
+		err := b.native.Add(path)
+		if err == nil {
+			b.watched[path] = true
+			return nil
+		}
+		if !isWatchLimit(err) {
+			return err
+		}
+
+		b.budget = len(b.watched)
+		ui.PrintWarning(fmt.Sprintf("Ran out of inotify watches after %d directories; polling the others every %s", b.budget, b.polling.interval))
+	}
+
+	return b.polling.Add(path)
+}
+
+// Remove stops watching a directory, freeing its inotify watch if it had one
+func (b *budgetWatcher) Remove(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.watched[path] {
+		delete(b.watched, path)
+		return b.native.Remove(path)
+	}
+	return b.polling.Remove(path)
+}
+
+// WatchList returns the watched and the polled directories
+func (b *budgetWatcher) WatchList() []string {
+	return append(b.native.WatchList(), b.polling.WatchList()...)
+}
+
+// Usage returns the number of directories watched with inotify and polled
+func (b *budgetWatcher) Usage() (watched, polled int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.watched), len(b.polling.WatchList())
+}
+
+func (b *budgetWatcher) Events() <-chan fsnotify.Event { return b.events }
+func (b *budgetWatcher) Errors() <-chan error          { return b.errors }
+
+// Name reports whether the budget ran out
+func (b *budgetWatcher) Name() string {
+	if _, polled := b.Usage(); polled > 0 {
+		return "fsnotify+poll"
+	}
+	return "fsnotify"
+}
+
+// Close stops both backends
+func (b *budgetWatcher) Close() error {
+	b.close.Do(func() { close(b.done) })
+	b.polling.Close()
+	return b.native.Close()
+}
@@ -1,9 +1,10 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +12,7 @@ import (
 
 	"config_handler/git"
 	"config_handler/notification"
+	"config_handler/state"
 	"config_handler/ui"
 
 	"github.com/fsnotify/fsnotify"
@@ -19,86 +21,177 @@ import (
 
 // Manager handles configuration file management
 type Manager struct {
-	ConfigDir     string
-	RepoDir       string
-	GitRepo       *git.GitRepo
-	FileWatcher   *fsnotify.Watcher
-	IncludeGlobs  []glob.Glob
-	ExcludeGlobs  []glob.Glob
-	SyncInterval  time.Duration
-	Verbose       bool
-	NotifyManager *notification.Manager
+	ConfigDir           string
+	RepoDir             string
+	GitRepo             *git.GitRepo
+	FileWatcher         Watcher
+	IncludeGlobs        []glob.Glob
+	ExcludeGlobs        []glob.Glob
+	MaintenanceInterval time.Duration
+	Verbose             bool
+	NotifyManager       *notification.Manager
+
+	// QuietPeriod is how long a path must go without changes before it is
+	// synced; MaxLatency caps the wait for paths that keep changing
+	QuietPeriod time.Duration
+	MaxLatency  time.Duration
+
+	// StormThreshold is the number of changes within StormWindow that starts
+	// a storm, which is committed at once when it ends (0 disables this)
+	StormThreshold int
+	StormWindow    time.Duration
+	stormNote      string
+
+	// RescanInterval is how often the config directory is compared with the
+	// repository to catch changes the watcher missed (0 disables this)
+	RescanInterval time.Duration
+
+	// WatcherBackend selects how changes are detected (see watcher.go);
+	// PollInterval is how often the polling backend scans
+	WatcherBackend string
+	PollInterval   time.Duration
+	recordedUsage  [2]int // Watched and polled directories last stored in State
+	recordedAt     time.Time
+
+	// stopRequests asks the watcher loop to stop; see Stop
+	stopRequests chan chan error
+	loopDone     chan struct{}
+	syncErr      error // Result of the last commit and push
+
+	// Rename events paired by the watcher, mapping new paths to old ones
+	renameHints   map[string]string
+	lastRenamed   string
+	lastRenamedAt time.Time
+
+	// MaxDeletePercent is the largest share of tracked files a single batch may
+	// delete before syncing is paused for confirmation (0 disables the check)
+	MaxDeletePercent int
+
+	// Interactive lets the safety checks ask before syncing anyway, for
+	// one-shot runs; otherwise syncing pauses until the resume command
+	Interactive bool
+
+	// State persists the trash between runs; deletions stay in the repository
+	// for TrashGracePeriod before they are committed (0 deletes immediately)
+	State            *state.Store
+	TrashGracePeriod time.Duration
+
+	// PreserveXattrs copies extended attributes along with file contents
+	PreserveXattrs bool
+
+	// RecordOwnership stores owner and group in the permission manifest
+	RecordOwnership bool
+
+	// SymlinkPolicy is the default policy for symbolic links; see SetSymlinkRules
+	SymlinkPolicy  SymlinkPolicy
+	symlinkRules   []symlinkMatcher
+	symlinkSources []SymlinkRule
+
+	// ConfigFile is watched while running; on change LoadConfig builds a
+	// manager from it whose rules and settings replace the current ones
+	ConfigFile     string
+	LoadConfig     func() (*Manager, error)
+	configWatcher  *fsnotify.Watcher
+	configFilePath string
+
+	// RepoPrefix is the directory of the repository that RepoDir points at
+	// when several roots share the repository; see SetRoot
+	RepoPrefix string
+	repoRoot   string
+	otherRoots []Root
+	reserved   []reservedPath
+
+	// InPlace tracks the files in ConfigDir where they are instead of copying
+	// them; RepoDir then holds the git directory (see inplace.go)
+	InPlace bool
+
+	includePatterns []string // Source patterns of IncludeGlobs, for explanations
+	excludePatterns []string
+	ignoreRules     []ignoreRule
+	manifest        *Manifest
+	syncPaused      bool
+	heldAtStart     []string // Deletions the initial sync left for the watcher to retry
 }
 
 // NewManager creates a new configuration manager
-func NewManager(configDir, repoDir string, gitRepo *git.GitRepo, includePatterns, excludePatterns []string, syncInterval time.Duration, verbose bool, notifyManager *notification.Manager) *Manager {
+func NewManager(configDir, repoDir string, gitRepo *git.GitRepo, includePatterns, excludePatterns []string, maintenanceInterval time.Duration, verbose bool, notifyManager *notification.Manager) *Manager {
 	// Compile include/exclude patterns to glob matchers
 	includeGlobs := make([]glob.Glob, 0, len(includePatterns))
+	validIncludes := make([]string, 0, len(includePatterns))
 	for _, pattern := range includePatterns {
 		if pattern != "" {
 			g, err := glob.Compile(pattern)
 			if err == nil {
 				includeGlobs = append(includeGlobs, g)
+				validIncludes = append(validIncludes, pattern)
 			}
 		}
 	}
 
 	excludeGlobs := make([]glob.Glob, 0, len(excludePatterns))
+	validExcludes := make([]string, 0, len(excludePatterns))
 	for _, pattern := range excludePatterns {
 		if pattern != "" {
 			g, err := glob.Compile(pattern)
 			if err == nil {
 				excludeGlobs = append(excludeGlobs, g)
+				validExcludes = append(validExcludes, pattern)
 			}
 		}
 	}
 
 	return &Manager{
-		ConfigDir:     configDir,
-		RepoDir:       repoDir,
-		GitRepo:       gitRepo,
-		IncludeGlobs:  includeGlobs,
-		ExcludeGlobs:  excludeGlobs,
-		SyncInterval:  syncInterval,
-		Verbose:       verbose,
-		NotifyManager: notifyManager,
+		ConfigDir:           configDir,
+		RepoDir:             repoDir,
+		GitRepo:             gitRepo,
+		IncludeGlobs:        includeGlobs,
+		ExcludeGlobs:        excludeGlobs,
+		MaintenanceInterval: maintenanceInterval,
+		QuietPeriod:         DefaultQuietPeriod,
+		MaxLatency:          DefaultMaxLatency,
+		StormThreshold:      DefaultStormThreshold,
+		StormWindow:         DefaultStormWindow,
+		RescanInterval:      DefaultRescanInterval,
+		WatcherBackend:      BackendAuto,
+		PollInterval:        DefaultPollInterval,
+		Verbose:             verbose,
+		NotifyManager:       notifyManager,
+		includePatterns:     validIncludes,
+		excludePatterns:     validExcludes,
 	}
 }
 
-// shouldInclude determines if a file/directory should be included based on patterns
-func (m *Manager) shouldInclude(relPath string) bool {
-	// Skip git metadata
-	if strings.Contains(relPath, ".git") {
-		return false
+// shouldInclude determines if a file/directory should be included based on
+// patterns and the ignore files
+func (m *Manager) shouldInclude(relPath string, isDir bool) bool {
+	decision := m.decide(relPath, isDir)
+	if !decision.Included && decision.explicit && m.Verbose {
+		ui.PrintInfo(fmt.Sprintf("Excluding %s (%s)", relPath, decision.Reason))
 	}
+	return decision.Included
+}
 
-	// Check exclude patterns (exclude takes precedence)
-	for _, pattern := range m.ExcludeGlobs {
-		if pattern.Match(relPath) {
-			if m.Verbose {
-				ui.PrintInfo(fmt.Sprintf("Excluding %s (matched exclude pattern)", relPath))
-			}
-			return false
-		}
+// shouldWalk determines if a directory should be walked (and watched), either
+// because it is included or because it may contain included paths
+func (m *Manager) shouldWalk(relPath string) bool {
+	decision := m.decide(relPath, true)
+	return decision.Included || decision.Descend
+}
+
+// InitialSync copies all configuration files to the repo
+func (m *Manager) InitialSync() error {
+	if m.InPlace {
+		return m.initialSyncInPlace()
 	}
+	defer m.LockWorkTree()()
 
-	// If include patterns are specified, path must match at least one
-	if len(m.IncludeGlobs) > 0 {
-		for _, pattern := range m.IncludeGlobs {
-			if pattern.Match(relPath) {
-				return true
-			}
+	// Refuse to sync from a missing or empty config directory
+	if err := m.checkSourceAvailable(); err != nil {
+		if errors.Is(err, os.ErrNotExist) || !m.Interactive || !m.confirmUnsafeSync(err.Error()) {
+			return fmt.Errorf("refusing to sync: %w", err)
 		}
-		// If we have include patterns but none matched, exclude the path
-		return false
 	}
 
-	// No include patterns specified, include everything not excluded
-	return true
-}
-
-// InitialSync copies all configuration files to the repo
-func (m *Manager) InitialSync() error {
 	// Create the repository directory if it doesn't exist
 	if _, err := os.Stat(m.RepoDir); os.IsNotExist(err) {
 		err = os.MkdirAll(m.RepoDir, 0755)
@@ -109,39 +202,42 @@ func (m *Manager) InitialSync() error {
 
 	fileCount := 0
 	dirCount := 0
+	skipped := &skipReport{}
+	hardlinks := make(hardlinkTracker)
 
 	// Walk the config directory and copy files to the repo
-	err := filepath.Walk(m.ConfigDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Calculate relative path from config directory
-		relPath, err := filepath.Rel(m.ConfigDir, path)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path: %w", err)
+	err := m.walkConfig(m.ConfigDir, skipped, func(relPath, path string, info os.FileInfo) error {
+		// Walk directories that may contain included paths, but only copy
+		// included ones
+		if info.IsDir() && !m.shouldWalk(relPath) {
+			return filepath.SkipDir
 		}
-
-		// Skip the root directory
-		if relPath == "." {
+		if !m.shouldInclude(relPath, info.IsDir()) {
 			return nil
 		}
 
-		// Check if this path should be included
-		if !m.shouldInclude(relPath) {
-			if info.IsDir() {
-				return filepath.SkipDir
+		// Target path in the repo
+		targetPath := filepath.Join(m.RepoDir, relPath)
+
+		// Further links to a file already copied are only recorded in the manifest
+		if primary, ok := hardlinks.primary(relPath, info); ok {
+			if _, err := os.Lstat(targetPath); err == nil {
+				if err := m.removeFromRepo(relPath); err != nil {
+					return fmt.Errorf("failed to remove duplicate %s: %w", relPath, err)
+				}
 			}
+			m.recordHardlink(relPath, primary)
+			skipped.add("hard link stored once", relPath+" → "+primary)
 			return nil
 		}
 
-		// Target path in the repo
-		targetPath := filepath.Join(m.RepoDir, relPath)
+		// Remember the mode git can't store
+		m.recordMetadata(relPath, info)
 
 		if info.IsDir() {
 			// Create directory if it doesn't exist
-			if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-				err = os.MkdirAll(targetPath, info.Mode())
+			if targetInfo, err := os.Lstat(targetPath); os.IsNotExist(err) || (err == nil && !targetInfo.IsDir()) {
+				err = ensureDir(targetPath, info.Mode())
 				if err != nil {
 					return fmt.Errorf("failed to create directory %s: %w", targetPath, err)
 				}
@@ -152,13 +248,13 @@ func (m *Manager) InitialSync() error {
 			}
 		} else {
 			// Make sure the target directory exists
-			err = os.MkdirAll(filepath.Dir(targetPath), 0755)
+			err := os.MkdirAll(filepath.Dir(targetPath), 0755)
 			if err != nil {
 				return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(targetPath), err)
 			}
 
-			// Copy the file
-			err = copyFile(path, targetPath)
+			// Copy the file (or the link itself for the link policy)
+			err = m.copyEntry(path, targetPath, info)
 			if err != nil {
 				return fmt.Errorf("failed to copy file %s to %s: %w", path, targetPath, err)
 			}
@@ -177,11 +273,63 @@ func (m *Manager) InitialSync() error {
 		return fmt.Errorf("failed to sync config files: %w", err)
 	}
 
+	skipped.print(m.Verbose)
+
+	// Remove files that were deleted from the config directory while we were not running
+	var deletedFiles []string
+	staleFiles, err := m.findDeletedFiles()
+	if err != nil {
+		return fmt.Errorf("failed to reconcile deleted files: %w", err)
+	}
+
+	// With a grace period, deletions wait in the trash and only expired ones are removed
+	if m.trashEnabled() {
+		for _, relPath := range staleFiles {
+			if _, err := m.moveToTrash(relPath); err != nil {
+				return fmt.Errorf("failed to move %s to trash: %w", relPath, err)
+			}
+		}
+
+		staleFiles, err = m.collectExpiredTrash()
+		if err != nil {
+			return fmt.Errorf("failed to read trash: %w", err)
+		}
+	}
+
+	if limitErr := m.checkDeletionLimit(len(staleFiles)); limitErr != nil && !m.confirmUnsafeSync(limitErr.Error()) {
+		ui.PrintWarning(fmt.Sprintf("Keeping %d deleted files in the repository", len(staleFiles)))
+		if !m.trashEnabled() {
+			// Expired trash is retried anyway; other deletions wait in the watcher
+			m.heldAtStart = staleFiles
+		}
+	} else {
+		deletedFiles = m.removeDeletedFiles(staleFiles)
+		if m.trashEnabled() {
+			if err := m.State.RemoveFromTrash(m.repoPaths(deletedFiles)); err != nil {
+				return fmt.Errorf("failed to update trash: %w", err)
+			}
+		}
+	}
+
 	// Commit and push changes
 	ui.PrintInfo(fmt.Sprintf("Synchronized %d files and %d directories", fileCount, dirCount))
+	if len(deletedFiles) > 0 {
+		ui.PrintInfo(fmt.Sprintf("Removed %d files deleted from the configuration directory", len(deletedFiles)))
+	}
 	ui.PrintInfo("Committing changes to repository...")
 
-	err = m.GitRepo.SyncWithRemote("Initial sync of configuration files")
+	m.pruneManifest()
+	err = m.saveManifest()
+	if err != nil {
+		return fmt.Errorf("failed to update manifest: %w", err)
+	}
+
+	commitMsg := "Initial sync of configuration files"
+	if len(deletedFiles) > 0 {
+		commitMsg += "; deleted: " + summarizeFileList(strings.Join(deletedFiles, ", "))
+	}
+
+	err = m.syncWithRemote(commitMsg)
 	if err != nil {
 		return fmt.Errorf("failed to sync with remote: %w", err)
 	}
@@ -191,67 +339,193 @@ func (m *Manager) InitialSync() error {
 
 // StartWatcher initializes and starts a file watcher to detect changes
 func (m *Manager) StartWatcher() error {
-	watcher, err := fsnotify.NewWatcher()
+	// Watch every directory that may contain included paths, following
+	// directory links according to the symlink policy
+	plan, err := m.watchPlan()
+	if err != nil {
+		return fmt.Errorf("failed to set up file watching: %w", err)
+	}
+
+	watcher, err := m.newWatcher(len(plan))
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
 	}
 	m.FileWatcher = watcher
 
-	// Start watching the config directory recursively
-	err = filepath.Walk(m.ConfigDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for _, dir := range plan {
+		err := watcher.Add(dir.path)
+		switch {
+		case err != nil && dir.relPath == ".":
+			// New top-level entries show up in the config directory itself
+			return fmt.Errorf("failed to watch %s: %w", m.ConfigDir, watchError(err))
+		case err != nil:
+			ui.PrintError(fmt.Sprintf("Failed to watch %s: %v", dir.relPath, watchError(err)))
+		case m.Verbose && dir.relPath != ".":
+			ui.PrintInfo(fmt.Sprintf("Watching directory: %s", dir.relPath))
 		}
+	}
 
-		// Calculate relative path from config directory
-		relPath, err := filepath.Rel(m.ConfigDir, path)
+	if m.Verbose {
+		watched, polled := watcher.Usage()
+		ui.PrintInfo(fmt.Sprintf("Watching %d directories with inotify and polling %d", watched, polled))
+	}
+	m.recordWatcherStatus()
+
+	// Watch the config file to reload it when it changes
+	if m.ConfigFile != "" && m.LoadConfig != nil {
+		m.configWatcher, m.configFilePath, err = m.watchConfigFile()
 		if err != nil {
-			return fmt.Errorf("failed to get relative path: %w", err)
+			ui.PrintWarning("Not watching " + m.ConfigFile + " for changes: " + err.Error())
 		}
+	}
 
-		// Skip the root directory
-		if relPath == "." {
-			return nil
+	// Start the watcher goroutine
+	m.stopRequests, m.loopDone = make(chan chan error), make(chan struct{})
+	go m.watcherLoop()
+
+	return nil
+}
+
+// watcherLoop handles file system events. Changed paths are synced once they
+// settle, and the config file once it has settled; the maintenance interval
+// drives the trash, status updates and retries.
+func (m *Manager) watcherLoop() {
+	defer close(m.loopDone)
+
+	changes := newDebouncer(m.QuietPeriod, m.MaxLatency)
+	storm := newStormDetector(m.StormThreshold, m.StormWindow)
+	heldFiles := make(map[string]bool)          // Changes held back while syncing is paused
+	unstableSince := make(map[string]time.Time) // Files found still being written
+	maintenanceTicker := time.NewTicker(m.MaintenanceInterval)
+
+	for _, relPath := range m.heldAtStart {
+		heldFiles[relPath] = true
+	}
+	m.heldAtStart = nil
+
+	sync := func(filesToSync map[string]bool) {
+		// Retry changes held back by the safety checks
+		for relPath := range heldFiles {
+			filesToSync[relPath] = true
 		}
 
-		// Check if this path should be included
-		if !m.shouldInclude(relPath) {
-			if info.IsDir() {
-				return filepath.SkipDir
+		// Files still being written wait to settle again, unless they have
+		// been changing for longer than the maximum latency
+		now := time.Now()
+		for relPath := range m.unstableFiles(filesToSync) {
+			since, ok := unstableSince[relPath]
+			if !ok {
+				unstableSince[relPath] = now
+			} else if now.Sub(since) >= m.MaxLatency {
+				ui.PrintWarning(fmt.Sprintf("%s is still being written after %s; syncing it anyway", relPath, m.MaxLatency))
+				continue
 			}
-			return nil
+
+			if m.Verbose {
+				ui.PrintInfo(fmt.Sprintf("Waiting for %s to be written completely", relPath))
+			}
+			delete(filesToSync, relPath)
+			changes.add(relPath, now)
+		}
+		for relPath := range filesToSync {
+			delete(unstableSince, relPath)
 		}
 
-		if info.IsDir() {
-			err = watcher.Add(path)
-			if err != nil {
-				log.Printf("Error watching directory %s: %v", path, err)
-			} else if m.Verbose {
-				ui.PrintInfo(fmt.Sprintf("Watching directory: %s", relPath))
+		if len(filesToSync) > 0 {
+			if m.syncChangedFiles(filesToSync) {
+				heldFiles = make(map[string]bool)
+			} else {
+				heldFiles = filesToSync
 			}
 		}
+	}
 
-		return nil
-	})
+	// A storm is committed as a whole once it is over
+	endStorm := func(now time.Time) {
+		if !storm.over(now, len(changes.pending) == 0) {
+			return
+		}
 
-	if err != nil {
-		return fmt.Errorf("failed to set up file watching: %w", err)
+		files, count := storm.take()
+		m.stormNote = m.describeStorm(files, count)
+		sync(files)
+		m.stormNote = ""
 	}
 
-	// Start the watcher goroutine
-	go m.watcherLoop()
+	// Rescans queue the paths the watcher missed like any other change
+	lastRescan := time.Now()
+	rescanPending := false
+	rescan := func(reason string) {
+		lastRescan, rescanPending = time.Now(), false
 
-	return nil
-}
+		unsynced, err := m.rescan()
+		if err != nil {
+			ui.PrintError("Rescan failed: " + err.Error())
+			return
+		}
+		if len(unsynced) == 0 {
+			if m.Verbose {
+				ui.PrintInfo(reason + " found nothing out of sync")
+			}
+			return
+		}
 
-// watcherLoop handles file system events
-func (m *Manager) watcherLoop() {
-	debounceEvents := make(map[string]time.Time)
-	syncTicker := time.NewTicker(m.SyncInterval)
+		ui.PrintWarning(fmt.Sprintf("%s found %d paths out of sync", reason, len(unsynced)))
+		now := time.Now()
+		for relPath := range unsynced {
+			changes.add(relPath, now)
+		}
+	}
+
+	// Changes to the config file are applied once it has settled
+	var configEvents chan fsnotify.Event
+	var configErrors chan error
+	configSettled := time.NewTimer(time.Hour)
+	configSettled.Stop()
+	if m.configWatcher != nil {
+		configEvents = m.configWatcher.Events
+		configErrors = m.configWatcher.Errors
+	}
 
 	for {
 		select {
-		case event, ok := <-m.FileWatcher.Events:
+		case event, ok := <-configEvents:
+			if !ok {
+				configEvents = nil
+				continue
+			}
+
+			// Wait for the editor to finish writing before reloading
+			if event.Name == m.configFilePath && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				configSettled.Reset(m.QuietPeriod)
+			}
+
+		case <-configSettled.C:
+			filesToSync := make(map[string]bool)
+			interval := m.MaintenanceInterval
+			for relPath := range m.reloadConfig() {
+				filesToSync[relPath] = true
+			}
+			if m.MaintenanceInterval != interval {
+				maintenanceTicker.Reset(m.MaintenanceInterval)
+			}
+			changes.setPeriods(m.QuietPeriod, m.MaxLatency)
+			storm.setLimits(m.StormThreshold, m.StormWindow)
+
+			if storm.active() {
+				storm.hold(filesToSync)
+			} else if len(filesToSync) > 0 {
+				sync(filesToSync)
+			}
+
+		case err, ok := <-configErrors:
+			if !ok {
+				configErrors = nil
+				continue
+			}
+			ui.PrintError("Config file watcher error: " + err.Error())
+
+		case event, ok := <-m.FileWatcher.Events():
 			if !ok {
 				return
 			}
@@ -262,71 +536,190 @@ func (m *Manager) watcherLoop() {
 				continue
 			}
 
-			// Check if this path should be included
-			if !m.shouldInclude(relPath) {
-				continue
+			// Pick up edited ignore files before checking the path
+			if filepath.Base(relPath) == IgnoreFile {
+				if err := m.LoadIgnoreFiles(); err != nil {
+					ui.PrintError(err.Error())
+				} else if m.Verbose {
+					ui.PrintInfo("Reloaded " + IgnoreFile + " rules")
+				}
 			}
 
 			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
-				// Debounce by recording the event time
-				debounceEvents[event.Name] = time.Now()
-
-				// If it's a new directory, add it to the watcher
-				if event.Op&fsnotify.Create != 0 {
-					info, err := os.Stat(event.Name)
-					if err == nil && info.IsDir() {
-						m.FileWatcher.Add(event.Name)
-						if m.Verbose {
-							ui.PrintInfo(fmt.Sprintf("Added new directory to watch: %s", relPath))
-						}
+				isDir := m.isDirPath(relPath)
+
+				// Watch a new directory that may contain included paths, and
+				// pick up what was created in it before the watch was added
+				now := time.Now()
+				if event.Op&fsnotify.Create != 0 && isDir && m.shouldWalk(relPath) {
+					for found := range m.watchNewDir(relPath) {
+						changes.add(found, now)
+					}
+				}
+
+				// Check if this path should be included
+				if !m.shouldInclude(relPath, isDir) {
+					continue
+				}
+
+				// Wait for the path to settle before syncing it
+				changes.add(relPath, now)
+				m.noteRenameEvent(event, relPath, now)
+
+				if storm.record(now) {
+					message := fmt.Sprintf("More than %d changes within %s; holding commits until the burst is over", m.StormThreshold, m.StormWindow)
+					ui.PrintWarning(message)
+					if m.NotifyManager != nil {
+						m.NotifyManager.StormDetected(message)
 					}
 				}
 			}
 
-		case err, ok := <-m.FileWatcher.Errors:
+		case err, ok := <-m.FileWatcher.Errors():
 			if !ok {
 				return
 			}
 			ui.PrintError("Watcher error: " + err.Error())
 
-		case <-syncTicker.C:
-			// Process debounced events
+			// Events were lost, so look for the changes they described
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				if time.Since(lastRescan) < m.QuietPeriod {
+					rescanPending = true
+				} else {
+					rescan("Rescan after the event queue overflowed")
+				}
+			}
+
+		case <-changes.C():
+			// The timer may fire for a path whose deadline has moved on
 			now := time.Now()
-			filesToSync := make(map[string]bool)
+			if ready := changes.ready(now); storm.active() {
+				storm.hold(ready)
+				endStorm(now)
+			} else if len(ready) > 0 {
+				sync(ready)
+			}
 
-			for eventPath, eventTime := range debounceEvents {
-				// Only process events older than 1 second
-				if now.Sub(eventTime) > 1*time.Second {
-					// Get the relative path for syncing
-					relPath, err := filepath.Rel(m.ConfigDir, eventPath)
-					if err == nil {
-						filesToSync[relPath] = true
-					}
-					delete(debounceEvents, eventPath)
+		case done := <-m.stopRequests:
+			// Commit everything still waiting, whether it has settled or not
+			maintenanceTicker.Stop()
+			pending := changes.takeAll()
+			if storm.active() {
+				files, count := storm.take()
+				for relPath := range files {
+					pending[relPath] = true
 				}
+				m.stormNote = m.describeStorm(files, count)
 			}
+			for relPath := range heldFiles {
+				pending[relPath] = true
+			}
+			done <- m.shutdown(pending)
+			return
+
+		case <-maintenanceTicker.C:
+			// Remove trashed files whose grace period has elapsed
+			m.purgeExpiredTrash()
+			m.recordWatcherStatus()
 
-			if len(filesToSync) > 0 {
-				// Sync changed files
-				m.syncChangedFiles(filesToSync)
+			now := time.Now()
+			filesToSync := make(map[string]bool)
+
+			if rescanPending {
+				rescan("Rescan after the event queue overflowed")
+			} else if m.RescanInterval > 0 && now.Sub(lastRescan) >= m.RescanInterval {
+				rescan("Periodic rescan")
+			}
+
+			if storm.active() {
+				storm.hold(filesToSync)
+				endStorm(now)
+			} else {
+				sync(filesToSync)
+			}
+
+			// End a pause that has nothing held back once it is resumed
+			if m.syncPaused && len(heldFiles) == 0 {
+				m.syncAllowed(nil)
 			}
 		}
 	}
 }
 
-// syncChangedFiles synchronizes changed files with the repository
-func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
+// syncChangedFiles synchronizes changed files with the repository. It returns
+// false if the changes were held back because syncing is paused.
+func (m *Manager) syncChangedFiles(changedFiles map[string]bool) bool {
+	if !m.syncAllowed(changedFiles) {
+		return false
+	}
+
+	if m.InPlace {
+		m.syncChangedFilesInPlace(changedFiles)
+		return true
+	}
+	defer m.LockWorkTree()()
+
 	fileChangeSummary := make(map[string]string) // Track types of changes for commit message
 	fileChanges := make(map[string][]string)     // Store file paths by operation for UI display
 
+	// Renamed files are moved in the repository instead of deleted and added
+	renamed := make(map[string]bool)
+	renames := m.detectRenames(changedFiles, func(relPath string) bool {
+		info, err := os.Lstat(filepath.Join(m.RepoDir, relPath))
+		return err == nil && !info.IsDir()
+	})
+	for newPath, oldPath := range renames {
+		if err := m.renameInRepo(oldPath, newPath); err != nil {
+			ui.PrintError("Failed to rename " + renameLabel(oldPath, newPath) + ": " + err.Error())
+			continue
+		}
+		renamed[oldPath], renamed[newPath] = true, true
+
+		label := renameLabel(oldPath, newPath)
+		fileChanges["renamed"] = append(fileChanges["renamed"], label)
+		fileChangeSummary["renamed"] = fileChangeSummary["renamed"] + label + ", "
+	}
+
+	// A deleted first link hands the content it stored over to another link
+	if promoted := m.promoteHardlinks(changedFiles); len(promoted) > 0 {
+		changedFiles = maps.Clone(changedFiles)
+		for _, relPath := range promoted {
+			changedFiles[relPath] = true
+		}
+	}
+
+	// New links to a stored file are recorded instead of copied again
+	links := m.linksInBatch(changedFiles)
+
 	for relPath := range changedFiles {
+		if renamed[relPath] {
+			continue
+		}
+
+		// Hard links share the repository copy of the first link
+		repoPath := m.resolveHardlink(relPath)
 		sourcePath := filepath.Join(m.ConfigDir, relPath)
-		targetPath := filepath.Join(m.RepoDir, relPath)
+		targetPath := filepath.Join(m.RepoDir, repoPath)
 
-		info, err := os.Stat(sourcePath)
-		if os.IsNotExist(err) {
-			// File or directory was deleted
-			targetInfo, targetErr := os.Stat(targetPath)
+		info, err := m.sourceInfo(relPath)
+		if errors.Is(err, errSymlinkSkipped) {
+			continue
+		} else if err == nil && specialFileKind(info.Mode()) != "" {
+			if m.Verbose {
+				ui.PrintInfo(fmt.Sprintf("Skipping %s %s", specialFileKind(info.Mode()), relPath))
+			}
+			continue
+		} else if os.IsNotExist(err) && m.trashEnabled() {
+			// Keep the repository copy in the trash until the grace period expires
+			trashed, trashErr := m.moveToTrash(relPath)
+			if trashErr != nil {
+				ui.PrintError("Failed to move " + relPath + " to trash: " + trashErr.Error())
+				continue
+			}
+			fileChanges["trashed"] = append(fileChanges["trashed"], trashed...)
+		} else if os.IsNotExist(err) {
+			// File or directory was deleted (never follow a link in the repo)
+			targetInfo, targetErr := os.Lstat(targetPath)
 			if targetErr == nil {
 				if targetInfo.IsDir() {
 					// Use the helper function to recursively remove directory
@@ -334,6 +727,7 @@ func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
 					if err != nil {
 						ui.PrintError("Failed to remove directory " + relPath + ": " + err.Error())
 					} else {
+						m.forgetMetadata(relPath)
 						if fileChanges["deleted"] == nil {
 							fileChanges["deleted"] = []string{}
 						}
@@ -346,6 +740,7 @@ func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
 					if err != nil && !os.IsNotExist(err) {
 						ui.PrintError("Failed to remove file " + relPath + ": " + err.Error())
 					} else {
+						m.forgetMetadata(relPath)
 						if fileChanges["deleted"] == nil {
 							fileChanges["deleted"] = []string{}
 						}
@@ -357,10 +752,11 @@ func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
 		} else if err == nil {
 			if info.IsDir() {
 				// Make sure the directory exists in the repo
-				err = os.MkdirAll(targetPath, info.Mode())
+				err = ensureDir(targetPath, info.Mode())
 				if err != nil {
 					ui.PrintError("Failed to create directory " + relPath + ": " + err.Error())
 				} else {
+					m.recordMetadata(relPath, info)
 					// Check if this is a new directory
 					if _, statErr := os.Stat(targetPath); os.IsNotExist(statErr) {
 						if fileChanges["added"] == nil {
@@ -380,26 +776,47 @@ func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
 
 				// Check if this is a new file or modified file
 				fileOperation := "modified"
-				if _, statErr := os.Stat(targetPath); os.IsNotExist(statErr) {
+				if _, statErr := os.Lstat(targetPath); os.IsNotExist(statErr) {
 					fileOperation = "added"
 				}
 
-				// Copy the file
-				err = copyFile(sourcePath, targetPath)
+				if primary, ok := links[relPath]; ok {
+					if err := m.removeFromRepo(relPath); err != nil {
+						ui.PrintError("Failed to remove duplicate " + relPath + ": " + err.Error())
+						continue
+					}
+					m.recordHardlink(relPath, primary)
+
+					label := relPath + " → " + primary
+					fileChanges[fileOperation] = append(fileChanges[fileOperation], label)
+					fileChangeSummary[fileOperation] = fileChangeSummary[fileOperation] + label + ", "
+					continue
+				}
+
+				// Copy the file (or the link itself for the link policy)
+				err = m.copyEntry(sourcePath, targetPath, info)
 				if err != nil {
 					ui.PrintError("Failed to copy file " + relPath + ": " + err.Error())
 					continue
 				}
+				m.recordMetadata(repoPath, info)
 
 				if fileChanges[fileOperation] == nil {
 					fileChanges[fileOperation] = []string{}
 				}
-				fileChanges[fileOperation] = append(fileChanges[fileOperation], relPath)
-				fileChangeSummary[fileOperation] = fileChangeSummary[fileOperation] + relPath + ", "
+				fileChanges[fileOperation] = append(fileChanges[fileOperation], repoPath)
+				fileChangeSummary[fileOperation] = fileChangeSummary[fileOperation] + repoPath + ", "
 			}
 		}
 	}
 
+	m.publishChanges(fileChanges, fileChangeSummary, len(changedFiles))
+	return true
+}
+
+// publishChanges shows the changes of a batch, sends a notification and commits
+// and pushes them
+func (m *Manager) publishChanges(fileChanges map[string][]string, fileChangeSummary map[string]string, total int) {
 	// Display changes with beautiful formatting
 	ui.PrintSection("Changes Detected")
 
@@ -442,6 +859,32 @@ func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
 		}
 	}
 
+	// Show renamed files
+	if len(fileChanges["renamed"]) > 0 {
+		ui.PrintInfo("Renamed files:")
+		for i, file := range fileChanges["renamed"] {
+			if i < 5 {
+				ui.PrintFileOperation("renamed", file)
+			} else {
+				ui.PrintInfo(fmt.Sprintf("... and %d more renamed files", len(fileChanges["renamed"])-5))
+				break
+			}
+		}
+	}
+
+	// Show files moved to the trash
+	if len(fileChanges["trashed"]) > 0 {
+		ui.PrintInfo(fmt.Sprintf("Moved to trash (removed from the repository after %s):", m.TrashGracePeriod))
+		for i, file := range fileChanges["trashed"] {
+			if i < 5 {
+				ui.PrintFileOperation("trashed", file)
+			} else {
+				ui.PrintInfo(fmt.Sprintf("... and %d more trashed files", len(fileChanges["trashed"])-5))
+				break
+			}
+		}
+	}
+
 	// Send desktop notification about file changes
 	if m.NotifyManager != nil {
 		changeText := ""
@@ -455,6 +898,12 @@ func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
 		if len(fileChanges["deleted"]) > 0 {
 			changeText += fmt.Sprintf("Deleted: %d files, ", len(fileChanges["deleted"]))
 		}
+		if len(fileChanges["renamed"]) > 0 {
+			changeText += fmt.Sprintf("Renamed: %d files, ", len(fileChanges["renamed"]))
+		}
+		if len(fileChanges["trashed"]) > 0 {
+			changeText += fmt.Sprintf("Trashed: %d files, ", len(fileChanges["trashed"]))
+		}
 
 		changeText = strings.TrimSuffix(changeText, ", ")
 
@@ -462,12 +911,21 @@ func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
 		m.NotifyManager.FileChangesDetected(changeText)
 	}
 
+	// Record the modes of the changed files
+	if err := m.saveManifest(); err != nil {
+		ui.PrintError("Failed to update manifest: " + err.Error())
+	}
+
 	// Create a detailed commit message
-	commitMsg := buildCommitMessage(fileChangeSummary, len(changedFiles))
+	commitMsg := buildCommitMessage(fileChangeSummary, total)
+	if m.stormNote != "" {
+		commitMsg = m.stormNote + "; " + commitMsg
+	}
 
 	// Sync with remote
 	ui.PrintInfo("Syncing changes with remote repository...")
-	err := m.GitRepo.SyncWithRemote(commitMsg)
+	err := m.syncWithRemote(commitMsg)
+	m.syncErr = err
 	if err != nil {
 		ui.PrintError("Failed to sync with remote: " + err.Error())
 
@@ -476,11 +934,11 @@ func (m *Manager) syncChangedFiles(changedFiles map[string]bool) {
 			m.NotifyManager.SyncError("Failed to sync with remote: " + err.Error())
 		}
 	} else {
-		ui.PrintSuccess(fmt.Sprintf("Successfully synchronized %d changed files", len(changedFiles)))
+		ui.PrintSuccess(fmt.Sprintf("Successfully synchronized %d changed files", total))
 
 		// Send success notification
 		if m.NotifyManager != nil {
-			m.NotifyManager.SyncSuccess(fmt.Sprintf("Successfully synchronized %d files", len(changedFiles)))
+			m.NotifyManager.SyncSuccess(fmt.Sprintf("Successfully synchronized %d files", total))
 		}
 	}
 	ui.PrintSeparator()
@@ -493,17 +951,7 @@ func buildCommitMessage(changes map[string]string, totalChanges int) string {
 	// Remove trailing comma and space from each change type
 	for changeType, files := range changes {
 		if files != "" {
-			// Trim trailing comma and space
-			files = strings.TrimSuffix(files, ", ")
-
-			// Limit long lists to 3 files + count of remaining
-			fileList := strings.Split(files, ", ")
-			if len(fileList) > 3 {
-				remaining := len(fileList) - 3
-				files = strings.Join(fileList[:3], ", ") + fmt.Sprintf(" and %d more", remaining)
-			}
-
-			parts = append(parts, fmt.Sprintf("%s: %s", changeType, files))
+			parts = append(parts, fmt.Sprintf("%s: %s", changeType, summarizeFileList(files)))
 		}
 	}
 
@@ -516,6 +964,22 @@ func buildCommitMessage(changes map[string]string, totalChanges int) string {
 	return fmt.Sprintf("Updated configuration files: %d files changed", totalChanges)
 }
 
+// summarizeFileList trims a comma-separated file list and limits it to 3 files
+// plus a count of the remaining ones
+func summarizeFileList(files string) string {
+	// Trim trailing comma and space
+	files = strings.TrimSuffix(files, ", ")
+
+	// Limit long lists to 3 files + count of remaining
+	fileList := strings.Split(files, ", ")
+	if len(fileList) > 3 {
+		remaining := len(fileList) - 3
+		files = strings.Join(fileList[:3], ", ") + fmt.Sprintf(" and %d more", remaining)
+	}
+
+	return files
+}
+
 // removeDirectory recursively removes a directory and all its contents
 func removeDirectory(path string) error {
 	// First, remove all contents of the directory
@@ -544,32 +1008,90 @@ func removeDirectory(path string) error {
 	return os.Remove(path)
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
+// copyFile copies a file from src to dst. The contents are written to a
+// temporary file that is synced and renamed over dst, so readers never see a
+// half-written file. Permissions and modification time are preserved, and
+// extended attributes too when preserveXattrs is set.
+func copyFile(src, dst string, preserveXattrs bool) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 
-	// Create the destination file
-	destFile, err := os.Create(dst)
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Create the temporary file next to the destination so the rename is atomic
+	tempFile, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
+	tempPath := tempFile.Name()
+
+	// Clean up the temporary file if anything fails before the rename
+	renamed := false
+	defer func() {
+		if !renamed {
+			tempFile.Close()
+			os.Remove(tempPath)
+		}
+	}()
 
 	// Copy the contents
-	_, err = io.Copy(destFile, sourceFile)
+	_, err = io.Copy(tempFile, sourceFile)
 	if err != nil {
 		return err
 	}
 
 	// Copy the permissions
-	sourceInfo, err := os.Stat(src)
+	err = tempFile.Chmod(sourceInfo.Mode())
+	if err != nil {
+		return err
+	}
+
+	if preserveXattrs {
+		err = copyXattrs(src, tempPath)
+		if err != nil {
+			return fmt.Errorf("failed to copy extended attributes: %w", err)
+		}
+	}
+
+	// Make sure the data is on disk before it replaces the destination
+	err = tempFile.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return err
+	}
+
+	// Copy the modification time
+	err = os.Chtimes(tempPath, sourceInfo.ModTime(), sourceInfo.ModTime())
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempPath, dst)
+	if err != nil {
+		return err
+	}
+	renamed = true
+
+	return syncDir(filepath.Dir(dst))
+}
+
+// syncDir flushes a directory entry so a completed rename survives a crash
+func syncDir(path string) error {
+	dir, err := os.Open(path)
 	if err != nil {
 		return err
 	}
+	defer dir.Close()
 
-	return os.Chmod(dst, sourceInfo.Mode())
+	return dir.Sync()
 }
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"time"
+)
+
+// Default debounce settings, used unless the manager is given others
+const (
+	DefaultQuietPeriod = time.Second
+	DefaultMaxLatency  = 30 * time.Second
+)
+
+// batchSlack lets paths that settle within moments of each other, such as the
+// two names of a renamed file, be synced in the same batch
+const batchSlack = 50 * time.Millisecond
+
+// pendingChange records when a path started and last stopped changing
+type pendingChange struct {
+	first time.Time
+	last  time.Time
+}
+
+// debouncer holds changed paths until they settle. A path is ready once it
+// hasn't changed for the quiet period, or once its first change has waited
+// for the maximum latency, so a file that is rewritten all the time is still
+// synced. A single timer fires at the earliest deadline.
+type debouncer struct {
+	quietPeriod time.Duration
+	maxLatency  time.Duration
+	pending     map[string]pendingChange
+	timer       *time.Timer
+	wake        time.Time
+}
+
+// newDebouncer creates a debouncer with no pending changes
+func newDebouncer(quietPeriod, maxLatency time.Duration) *debouncer {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	return &debouncer{
+		quietPeriod: quietPeriod,
+		maxLatency:  maxLatency,
+		pending:     make(map[string]pendingChange),
+		timer:       timer,
+	}
+}
+
+// C fires when a pending path may be ready
+func (d *debouncer) C() <-chan time.Time {
+	return d.timer.C
+}
+
+// setPeriods changes the quiet period and maximum latency, for config reloads
+func (d *debouncer) setPeriods(quietPeriod, maxLatency time.Duration) {
+	d.quietPeriod, d.maxLatency = quietPeriod, maxLatency
+	d.rearm()
+}
+
+// add records a change to relPath
+func (d *debouncer) add(relPath string, now time.Time) {
+	change, ok := d.pending[relPath]
+	if !ok {
+		change.first = now
+	}
+	change.last = now
+	d.pending[relPath] = change
+
+	// Later changes only move a deadline back, which the timer notices when
+	// it fires, so it is only brought forward here
+	d.arm(d.deadline(change))
+}
+
+// ready removes and returns the paths that have settled or waited too long,
+// and sets the timer for the rest
+func (d *debouncer) ready(now time.Time) map[string]bool {
+	ready := make(map[string]bool)
+	for relPath, change := range d.pending {
+		if !now.Add(batchSlack).Before(d.deadline(change)) {
+			ready[relPath] = true
+			delete(d.pending, relPath)
+		}
+	}
+
+	d.rearm()
+	return ready
+}
+
+// takeAll removes and returns every pending path, settled or not
+func (d *debouncer) takeAll() map[string]bool {
+	all := make(map[string]bool, len(d.pending))
+	for relPath := range d.pending {
+		all[relPath] = true
+	}
+	d.pending = make(map[string]pendingChange)
+	d.rearm()
+	return all
+}
+
+// deadline returns when a pending path becomes ready
+func (d *debouncer) deadline(change pendingChange) time.Time {
+	settled := change.last.Add(d.quietPeriod)
+	if capped := change.first.Add(d.maxLatency); d.maxLatency > 0 && capped.Before(settled) {
+		return capped
+	}
+	return settled
+}
+
+// rearm sets the timer for the earliest deadline of the pending paths
+func (d *debouncer) rearm() {
+	d.timer.Stop()
+	d.wake = time.Time{}
+	for _, change := range d.pending {
+		d.arm(d.deadline(change))
+	}
+}
+
+// arm makes the timer fire at t unless it already fires earlier
+func (d *debouncer) arm(t time.Time) {
+	if !d.wake.IsZero() && !t.Before(d.wake) {
+		return
+	}
+	d.wake = t
+	d.timer.Reset(time.Until(t))
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDebouncerReady(t *testing.T) {
+	type change struct {
+		path string
+		at   time.Duration
+	}
+
+	// A change every half second for the given time
+	steady := func(path string, until time.Duration) []change {
+		var changes []change
+		for at := time.Duration(0); at < until; at += 500 * time.Millisecond {
+			changes = append(changes, change{path, at})
+		}
+		return changes
+	}
+
+	tests := []struct {
+		name       string
+		maxLatency time.Duration
+		changes    []change
+		at         time.Duration
+		want       []string
+	}{
+		{
+			name:    "still within the quiet period",
+			changes: []change{{"a.conf", 0}},
+			at:      500 * time.Millisecond,
+		},
+		{
+			name:    "quiet period elapsed",
+			changes: []change{{"a.conf", 0}},
+			at:      time.Second,
+			want:    []string{"a.conf"},
+		},
+		{
+			name:    "settling within the batch slack",
+			changes: []change{{"a.conf", 0}, {"b.conf", 30 * time.Millisecond}},
+			at:      time.Second,
+			want:    []string{"a.conf", "b.conf"},
+		},
+		{
+			name:    "a later change restarts the quiet period",
+			changes: []change{{"a.conf", 0}, {"a.conf", 800 * time.Millisecond}},
+			at:      1500 * time.Millisecond,
+		},
+		{
+			name:    "only settled paths",
+			changes: []change{{"a.conf", 0}, {"b.conf", 800 * time.Millisecond}},
+			at:      1200 * time.Millisecond,
+			want:    []string{"a.conf"},
+		},
+		{
+			name:       "maximum latency reached",
+			maxLatency: 5 * time.Second,
+			changes:    steady("a.conf", 5*time.Second),
+			at:         5 * time.Second,
+			want:       []string{"a.conf"},
+		},
+		{
+			name:       "maximum latency not reached",
+			maxLatency: 5 * time.Second,
+			changes:    steady("a.conf", 5*time.Second),
+			at:         4900 * time.Millisecond,
+		},
+		{
+			name:    "no maximum latency",
+			changes: steady("a.conf", 10*time.Second),
+			at:      10 * time.Second,
+		},
+	}
+
+	start := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDebouncer(time.Second, tt.maxLatency)
+			for _, c := range tt.changes {
+				d.add(c.path, start.Add(c.at))
+			}
+
+			ready := slices.Sorted(maps.Keys(d.ready(start.Add(tt.at))))
+			if !slices.Equal(ready, tt.want) {
+				t.Errorf("ready = %v, want %v", ready, tt.want)
+			}
+			for _, path := range ready {
+				if _, pending := d.pending[path]; pending {
+					t.Errorf("%s is still pending after it was ready", path)
+				}
+			}
+		})
+	}
+}
+
+// Shutdown takes every pending path, whether it has settled or not
+func TestDebouncerTakeAll(t *testing.T) {
+	d := newDebouncer(time.Second, DefaultMaxLatency)
+	now := time.Now()
+	d.add("a.conf", now)
+	d.add("b.conf", now.Add(time.Second))
+
+	if all := d.takeAll(); !maps.Equal(all, map[string]bool{"a.conf": true, "b.conf": true}) {
+		t.Errorf("takeAll = %v, want both paths", all)
+	}
+	if len(d.pending) != 0 {
+		t.Errorf("pending after takeAll = %v, want none", d.pending)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package config
+
+import "os"
+
+// fileOwner is not supported on platforms without Unix file ownership
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
+
+// fileID is not supported on platforms without inode numbers, so hard links
+// are stored as separate files there
+func fileID(info os.FileInfo) (fileKey, uint64, bool) {
+	return fileKey{}, 0, false
+}
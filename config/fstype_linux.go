@@ -0,0 +1,31 @@
+//go:build linux
+
+package config
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// unwatchableFilesystems are the file systems whose changes, made on other
+// machines or by the FUSE daemon, never reach inotify
+var unwatchableFilesystems = map[uint32]string{
+	unix.NFS_SUPER_MAGIC:  "NFS",
+	unix.SMB_SUPER_MAGIC:  "SMB",
+	unix.SMB2_SUPER_MAGIC: "SMB",
+	unix.CIFS_SUPER_MAGIC: "CIFS",
+	unix.FUSE_SUPER_MAGIC: "FUSE",
+	unix.V9FS_MAGIC:       "9p",
+	unix.AFS_SUPER_MAGIC:  "AFS",
+}
+
+// unwatchableFilesystem returns the name of the file system path is on if
+// inotify doesn't see its changes
+func unwatchableFilesystem(path string) (string, bool) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return "", false
+	}
+
+	name, ok := unwatchableFilesystems[uint32(stat.Type)]
+	return name, ok
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package config
+
+// unwatchableFilesystem is only implemented on Linux; elsewhere the native
+// change notifications are trusted
+func unwatchableFilesystem(path string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"config_handler/state"
+	"config_handler/ui"
+)
+
+// minGuardedDeletions is the smallest number of deletions the percentage limit
+// applies to, so removing a couple of files from a small repository is never blocked
+const minGuardedDeletions = 5
+
+// checkSourceAvailable verifies that the config directory exists and is not empty
+func (m *Manager) checkSourceAvailable() error {
+	info, err := os.Stat(m.ConfigDir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("configuration directory %s does not exist (unmounted disk?): %w", m.ConfigDir, err)
+	} else if err != nil {
+		return fmt.Errorf("cannot access configuration directory %s: %w", m.ConfigDir, err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("configuration path %s is not a directory", m.ConfigDir)
+	}
+
+	entries, err := os.ReadDir(m.ConfigDir)
+	if err != nil {
+		return fmt.Errorf("cannot read configuration directory %s: %w", m.ConfigDir, err)
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("configuration directory %s is empty", m.ConfigDir)
+	}
+
+	return nil
+}
+
+// checkDeletionLimit returns an error if deleting the given number of files
+// would remove more than MaxDeletePercent of the tracked files
+func (m *Manager) checkDeletionLimit(deletions int) error {
+	if m.MaxDeletePercent <= 0 || deletions < minGuardedDeletions {
+		return nil
+	}
+
+	trackedFiles, err := m.trackedFiles()
+	if err != nil {
+		return fmt.Errorf("failed to list tracked files: %w", err)
+	}
+
+	if len(trackedFiles) == 0 {
+		return nil
+	}
+
+	if deletions*100 > m.MaxDeletePercent*len(trackedFiles) {
+		return fmt.Errorf("%d of %d tracked files would be deleted, which exceeds the %d%% limit",
+			deletions, len(trackedFiles), m.MaxDeletePercent)
+	}
+
+	return nil
+}
+
+// countDeletions counts how many tracked files a batch of changes would delete
+func (m *Manager) countDeletions(changedFiles map[string]bool) (int, error) {
+	trackedFiles, err := m.trackedFiles()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tracked files: %w", err)
+	}
+
+	count := 0
+	for relPath := range changedFiles {
+		if _, err := os.Lstat(filepath.Join(m.ConfigDir, relPath)); !os.IsNotExist(err) {
+			continue
+		}
+
+		// A deleted directory removes every tracked file below it
+		prefix := relPath + string(filepath.Separator)
+		for _, tracked := range trackedFiles {
+			if tracked == relPath || strings.HasPrefix(tracked, prefix) {
+				count++
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// checkSyncSafety runs the missing-source and mass-deletion checks for a batch of changes
+func (m *Manager) checkSyncSafety(changedFiles map[string]bool) error {
+	if err := m.checkSourceAvailable(); err != nil {
+		return err
+	}
+
+	deletions, err := m.countDeletions(changedFiles)
+	if err != nil {
+		return err
+	}
+
+	return m.checkDeletionLimit(deletions)
+}
+
+// syncAllowed decides whether a batch of changes may be synchronized. Unsafe
+// batches pause syncing until the problem goes away or the user resumes it.
+func (m *Manager) syncAllowed(changedFiles map[string]bool) bool {
+	err := m.checkSyncSafety(changedFiles)
+	if err == nil {
+		if m.syncPaused {
+			m.endPause()
+			ui.PrintSuccess("Safety checks passed, resuming synchronization")
+			if m.NotifyManager != nil {
+				m.NotifyManager.SyncSuccess("Safety checks passed, synchronization resumed")
+			}
+		}
+		return true
+	}
+
+	return m.confirmUnsafeSync(err.Error())
+}
+
+// confirmUnsafeSync decides whether changes that failed the safety checks are
+// synced anyway. One-shot runs ask the user. The daemon never blocks: it
+// records the pause in the state file, sends a critical notification and syncs
+// the held changes once the resume command has cleared the pause.
+func (m *Manager) confirmUnsafeSync(reason string) bool {
+	if m.Interactive {
+		m.announcePause(reason)
+		if ui.PromptYesNo("Sync these changes anyway?", false) {
+			m.syncPaused = false
+			ui.PrintWarning("Continuing synchronization as confirmed")
+			return true
+		}
+
+		ui.PrintWarning("Syncing is paused until the problem is resolved")
+		return false
+	}
+
+	if m.syncPaused {
+		if !m.pauseCleared() {
+			return false
+		}
+		m.syncPaused = false
+		ui.PrintWarning("Continuing synchronization as resumed")
+		return true
+	}
+
+	m.announcePause(reason)
+	if m.State != nil {
+		err := m.State.SetSyncPause(state.SyncPause{
+			Root:     m.ConfigDir,
+			PID:      os.Getpid(),
+			Reason:   reason,
+			PausedAt: time.Now(),
+		})
+		if err != nil {
+			ui.PrintError("Failed to record the pause: " + err.Error())
+		}
+	}
+	ui.PrintWarning("Syncing is paused until the problem is resolved or the resume command is run")
+	return false
+}
+
+// announcePause reports why syncing is paused
+func (m *Manager) announcePause(reason string) {
+	m.syncPaused = true
+
+	ui.PrintSection("Synchronization Paused")
+	ui.PrintError("Refusing to sync: " + reason)
+	if m.NotifyManager != nil {
+		m.NotifyManager.SyncPaused("Refusing to sync: " + reason)
+	}
+}
+
+// pauseCleared reports whether the resume command dropped the recorded pause
+func (m *Manager) pauseCleared() bool {
+	if m.State == nil {
+		return false
+	}
+
+	pause, err := m.State.SyncPauseFor(m.ConfigDir)
+	if err != nil {
+		ui.PrintError("Failed to read the pause: " + err.Error())
+		return false
+	}
+	return pause == nil
+}
+
+// endPause resumes syncing after the problem went away
+func (m *Manager) endPause() {
+	m.syncPaused = false
+	if m.State == nil {
+		return
+	}
+
+	if err := m.State.ClearSyncPause(m.ConfigDir); err != nil {
+		ui.PrintError("Failed to clear the pause: " + err.Error())
+	}
+}
+
+// SyncPause returns the pause a running instance recorded for this root, or
+// nil if syncing isn't paused
+func (m *Manager) SyncPause() (*state.SyncPause, error) {
+	if m.State == nil {
+		return nil, nil
+	}
+	return m.State.SyncPauseFor(m.ConfigDir)
+}
+
+// Resume clears the recorded pause, so that the running instance syncs the
+// changes it held back at its next retry
+func (m *Manager) Resume() error {
+	if m.State == nil {
+		return nil
+	}
+	return m.State.ClearSyncPause(m.ConfigDir)
+}
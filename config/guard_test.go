@@ -0,0 +1,125 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"config_handler/git"
+)
+
+// newTrackedManager returns a manager whose repository tracks the given
+// number of files
+func newTrackedManager(t *testing.T, tracked int) *Manager {
+	t.Helper()
+
+	configDir, repoDir := t.TempDir(), filepath.Join(t.TempDir(), "repo")
+	gitRepo, err := git.InitOrOpenRepo(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < tracked; i++ {
+		name := fmt.Sprintf("file%02d.conf", i)
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := gitRepo.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewManager(configDir, repoDir, gitRepo, nil, nil, time.Second, false, nil)
+}
+
+func TestCheckDeletionLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPercent int
+		deletions  int
+		wantErr    bool
+	}{
+		{"below the guarded minimum", 10, minGuardedDeletions - 1, false},
+		{"at the limit", 50, 10, false},
+		{"above the limit", 50, 11, true},
+		{"small limit", 10, minGuardedDeletions, true},
+		{"every file with the full limit", 100, 20, false},
+		{"disabled", 0, 20, false},
+	}
+
+	m := newTrackedManager(t, 20)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.MaxDeletePercent = tt.maxPercent
+			if err := m.checkDeletionLimit(tt.deletions); (err != nil) != tt.wantErr {
+				t.Errorf("checkDeletionLimit(%d) with %d%% = %v, want error %v", tt.deletions, tt.maxPercent, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckDeletionLimitWithoutTrackedFiles(t *testing.T) {
+	m := newTrackedManager(t, 0)
+	m.MaxDeletePercent = 10
+	if err := m.checkDeletionLimit(minGuardedDeletions); err != nil {
+		t.Errorf("checkDeletionLimit on an empty repository = %v, want nil", err)
+	}
+}
+
+func TestCheckSourceAvailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T) string
+		wantErr  bool
+		notExist bool
+	}{
+		{
+			name: "directory with files",
+			setup: func(t *testing.T) string {
+				dir := t.TempDir()
+				if err := os.WriteFile(filepath.Join(dir, "app.conf"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return dir
+			},
+		},
+		{
+			name:     "missing directory",
+			setup:    func(t *testing.T) string { return filepath.Join(t.TempDir(), "unmounted") },
+			wantErr:  true,
+			notExist: true,
+		},
+		{
+			name:    "empty directory",
+			setup:   func(t *testing.T) string { return t.TempDir() },
+			wantErr: true,
+		},
+		{
+			name: "regular file",
+			setup: func(t *testing.T) string {
+				path := filepath.Join(t.TempDir(), "config")
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return path
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(tt.setup(t), t.TempDir(), nil, nil, nil, time.Second, false, nil)
+			err := m.checkSourceAvailable()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkSourceAvailable() = %v, want error %v", err, tt.wantErr)
+			}
+			if errors.Is(err, os.ErrNotExist) != tt.notExist {
+				t.Errorf("checkSourceAvailable() = %v, want os.ErrNotExist %v", err, tt.notExist)
+			}
+		})
+	}
+}
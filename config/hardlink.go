@@ -0,0 +1,310 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileKey identifies a file independently of the names linking to it
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// hardlinkTracker remembers the first path seen for each file with several hard links
+type hardlinkTracker map[fileKey]string
+
+// primary returns the path a hard-linked file was first seen at. It reports
+// false, and remembers relPath, the first time a file is seen.
+func (t hardlinkTracker) primary(relPath string, info os.FileInfo) (string, bool) {
+	if !info.Mode().IsRegular() {
+		return "", false
+	}
+
+	key, nlink, ok := fileID(info)
+	if !ok || nlink < 2 {
+		return "", false
+	}
+
+	if first, seen := t[key]; seen {
+		return first, true
+	}
+	t[key] = relPath
+	return "", false
+}
+
+// recordHardlink stores relPath in the manifest as a hard link to primary
+// instead of keeping a second copy in the repository
+func (m *Manager) recordHardlink(relPath, primary string) {
+	manifest, err := m.loadManifest()
+	if err != nil {
+		return
+	}
+
+	entry := ManifestEntry{Hardlink: filepath.ToSlash(primary)}
+	key := filepath.ToSlash(relPath)
+	if manifest.Entries[key] != entry {
+		manifest.Entries[key] = entry
+		manifest.dirty = true
+	}
+}
+
+// hardlinkOf returns the first path recorded for a hard link, if relPath is one
+func (m *Manager) hardlinkOf(relPath string) (string, bool) {
+	manifest, err := m.loadManifest()
+	if err != nil {
+		return "", false
+	}
+
+	entry, ok := manifest.Entries[filepath.ToSlash(relPath)]
+	if !ok || entry.Hardlink == "" {
+		return "", false
+	}
+	return filepath.FromSlash(entry.Hardlink), true
+}
+
+// resolveHardlink returns the repository path holding the content of relPath:
+// the first link's path while relPath is still linked to it, relPath otherwise.
+// A record whose link has been broken (for example by an editor replacing the
+// file) is dropped so the file is synced on its own.
+func (m *Manager) resolveHardlink(relPath string) string {
+	primary, ok := m.hardlinkOf(relPath)
+	if !ok {
+		return relPath
+	}
+
+	linkInfo, errLink := os.Stat(filepath.Join(m.ConfigDir, relPath))
+	primaryInfo, errPrimary := os.Stat(filepath.Join(m.ConfigDir, primary))
+	if errLink == nil && errPrimary == nil && os.SameFile(linkInfo, primaryInfo) {
+		return primary
+	}
+
+	m.forgetMetadata(relPath)
+	return relPath
+}
+
+// linksInBatch returns the changed files that are further hard links to a
+// file the repository already stores or the batch syncs, mapped to the path
+// holding its content. Files already in the repository keep their copy, so
+// they are seen first.
+func (m *Manager) linksInBatch(changedFiles map[string]bool) map[string]string {
+	tracker := make(hardlinkTracker)
+	if manifest, err := m.loadManifest(); err == nil {
+		for _, entry := range manifest.Entries {
+			if entry.Hardlink == "" {
+				continue
+			}
+			primary := filepath.FromSlash(entry.Hardlink)
+			if info, err := os.Stat(filepath.Join(m.ConfigDir, primary)); err == nil {
+				tracker.primary(primary, info)
+			}
+		}
+	}
+
+	stored := func(relPath string) bool {
+		_, err := os.Lstat(filepath.Join(m.RepoDir, relPath))
+		return err == nil
+	}
+
+	var paths []string
+	for relPath := range changedFiles {
+		if m.resolveHardlink(relPath) == relPath {
+			paths = append(paths, relPath)
+		}
+	}
+	sort.Strings(paths)
+	sort.SliceStable(paths, func(i, j int) bool {
+		return stored(paths[i]) && !stored(paths[j])
+	})
+
+	links := make(map[string]string)
+	unmatched := make(map[fileKey]string) // New files whose other links weren't seen
+	for _, relPath := range paths {
+		info, err := os.Lstat(filepath.Join(m.ConfigDir, relPath))
+		if err != nil {
+			continue
+		}
+		if primary, ok := tracker.primary(relPath, info); ok && primary != relPath {
+			links[relPath] = primary
+		} else if key, nlink, ok := fileID(info); ok && nlink > 1 && info.Mode().IsRegular() && !stored(relPath) {
+			unmatched[key] = relPath
+		}
+	}
+
+	// A link to a file stored before the batch only changes the new path, so
+	// the stored copy is looked up by its inode
+	if len(unmatched) == 0 {
+		return links
+	}
+	for key, primary := range m.storedFiles(unmatched) {
+		first := unmatched[key]
+		links[first] = primary
+		for relPath, linked := range links {
+			if linked == first {
+				links[relPath] = primary
+			}
+		}
+	}
+	return links
+}
+
+// storedFiles returns, for each of the given files, the first path in the
+// repository whose config file is the same file
+func (m *Manager) storedFiles(keys map[fileKey]string) map[fileKey]string {
+	found := make(map[fileKey]string)
+	filepath.WalkDir(m.RepoDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(m.RepoDir, path)
+		if err != nil || isInternalFile(relPath) {
+			return nil
+		}
+		info, err := os.Lstat(filepath.Join(m.ConfigDir, relPath))
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if key, _, ok := fileID(info); ok {
+			if _, wanted := keys[key]; wanted && found[key] == "" {
+				found[key] = relPath
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// promoteHardlinks finds the hard links whose first path is deleted in this
+// batch and makes one of the remaining links of each file its new first path,
+// so that the shared content keeps a copy in the repository. It returns the
+// promoted paths, which are synced along with the batch.
+func (m *Manager) promoteHardlinks(changedFiles map[string]bool) []string {
+	manifest, err := m.loadManifest()
+	if err != nil {
+		return nil
+	}
+
+	links := make(map[string][]string)
+	for key, entry := range manifest.Entries {
+		if entry.Hardlink == "" {
+			continue
+		}
+		primary := filepath.FromSlash(entry.Hardlink)
+		if m.deletedInBatch(primary, changedFiles) {
+			links[primary] = append(links[primary], filepath.FromSlash(key))
+		}
+	}
+
+	var promoted []string
+	for _, paths := range links {
+		sort.Strings(paths)
+
+		var first string
+		var firstInfo os.FileInfo
+		for _, relPath := range paths {
+			// Links deleted as well are handled by their own deletion
+			info, err := os.Stat(filepath.Join(m.ConfigDir, relPath))
+			if err != nil {
+				continue
+			}
+
+			m.forgetMetadata(relPath)
+			switch {
+			case first == "":
+				first, firstInfo = relPath, info
+				promoted = append(promoted, relPath)
+			case os.SameFile(info, firstInfo):
+				m.recordHardlink(relPath, first)
+			default:
+				promoted = append(promoted, relPath)
+			}
+		}
+	}
+
+	return promoted
+}
+
+// deletedInBatch reports whether relPath is gone from the config directory
+// and the batch deletes it or one of its parent directories
+func (m *Manager) deletedInBatch(relPath string, changedFiles map[string]bool) bool {
+	if _, err := os.Lstat(filepath.Join(m.ConfigDir, relPath)); !os.IsNotExist(err) {
+		return false
+	}
+
+	for path := relPath; path != "." && path != string(filepath.Separator); path = filepath.Dir(path) {
+		if changedFiles[path] {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreHardlinks recreates the hard links recorded below relPath, linking
+// them to their already restored first path
+func (m *Manager) restoreHardlinks(relPath string, overwrite bool, summary *RestoreSummary) error {
+	manifest, err := m.loadManifest()
+	if err != nil {
+		return err
+	}
+
+	root := filepath.Clean(relPath)
+	for key, entry := range manifest.Entries {
+		if entry.Hardlink == "" {
+			continue
+		}
+
+		rel := filepath.FromSlash(key)
+		if root != "." && rel != root && !strings.HasPrefix(rel, root+string(filepath.Separator)) {
+			continue
+		}
+		if !m.shouldInclude(rel, false) {
+			continue
+		}
+
+		targetPath := filepath.Join(m.ConfigDir, rel)
+		primaryPath := filepath.Join(m.ConfigDir, filepath.FromSlash(entry.Hardlink))
+
+		primaryInfo, err := os.Stat(primaryPath)
+		if err != nil {
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("could not restore hard link %s: %s is missing", rel, entry.Hardlink))
+			continue
+		}
+
+		if targetInfo, err := os.Lstat(targetPath); err == nil {
+			if os.SameFile(targetInfo, primaryInfo) {
+				summary.Unchanged = append(summary.Unchanged, rel)
+				continue
+			}
+
+			if !overwrite {
+				summary.Conflicts = append(summary.Conflicts, rel)
+				continue
+			}
+
+			if err := os.Remove(targetPath); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", rel, err)
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(rel), err)
+		}
+
+		if err := os.Link(primaryPath, targetPath); err != nil {
+			return fmt.Errorf("failed to link %s to %s: %w", rel, entry.Hardlink, err)
+		}
+		summary.Restored = append(summary.Restored, rel)
+	}
+
+	return nil
+}
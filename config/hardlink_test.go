@@ -0,0 +1,152 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recordedLinks returns the hard links recorded in the manifest
+func recordedLinks(t *testing.T, m *Manager) map[string]string {
+	t.Helper()
+
+	manifest, err := m.loadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := make(map[string]string)
+	for key, entry := range manifest.Entries {
+		if entry.Hardlink != "" {
+			links[key] = entry.Hardlink
+		}
+	}
+	return links
+}
+
+func TestPromoteHardlinks(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        []string          // Written with distinct contents
+		links        map[string]string // Created as hard links and recorded
+		remove       []string          // Removed from the config directory
+		changed      []string
+		wantPromoted []string
+		wantLinks    map[string]string
+	}{
+		{
+			name:         "first path deleted",
+			files:        []string{"a.conf"},
+			links:        map[string]string{"b.conf": "a.conf", "c.conf": "a.conf"},
+			remove:       []string{"a.conf"},
+			changed:      []string{"a.conf"},
+			wantPromoted: []string{"b.conf"},
+			wantLinks:    map[string]string{"c.conf": "b.conf"},
+		},
+		{
+			name:         "parent directory of the first path deleted",
+			files:        []string{"dir/a.conf"},
+			links:        map[string]string{"b.conf": "dir/a.conf"},
+			remove:       []string{"dir"},
+			changed:      []string{"dir"},
+			wantPromoted: []string{"b.conf"},
+			wantLinks:    map[string]string{},
+		},
+		{
+			name:         "another link deleted in a later batch",
+			files:        []string{"a.conf"},
+			links:        map[string]string{"b.conf": "a.conf", "c.conf": "a.conf"},
+			remove:       []string{"a.conf", "c.conf"},
+			changed:      []string{"a.conf"},
+			wantPromoted: []string{"b.conf"},
+			wantLinks:    map[string]string{"c.conf": "a.conf"},
+		},
+		{
+			name:      "first path kept",
+			files:     []string{"a.conf"},
+			links:     map[string]string{"b.conf": "a.conf"},
+			changed:   []string{"b.conf"},
+			wantLinks: map[string]string{"b.conf": "a.conf"},
+		},
+		{
+			name:      "every link deleted",
+			files:     []string{"a.conf"},
+			links:     map[string]string{"b.conf": "a.conf"},
+			remove:    []string{"a.conf", "b.conf"},
+			changed:   []string{"a.conf", "b.conf"},
+			wantLinks: map[string]string{"b.conf": "a.conf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir := t.TempDir()
+			m := NewManager(configDir, t.TempDir(), nil, nil, nil, time.Second, false, nil)
+
+			for _, relPath := range tt.files {
+				path := filepath.Join(configDir, relPath)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(relPath), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for link, primary := range tt.links {
+				if err := os.Link(filepath.Join(configDir, primary), filepath.Join(configDir, link)); err != nil {
+					t.Skipf("hard links not supported: %v", err)
+				}
+				m.recordHardlink(link, primary)
+			}
+			for _, relPath := range tt.remove {
+				if err := os.RemoveAll(filepath.Join(configDir, relPath)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			changed := make(map[string]bool)
+			for _, relPath := range tt.changed {
+				changed[relPath] = true
+			}
+
+			promoted := m.promoteHardlinks(changed)
+			slices.Sort(promoted)
+			if !slices.Equal(promoted, tt.wantPromoted) {
+				t.Errorf("promoted = %v, want %v", promoted, tt.wantPromoted)
+			}
+			if links := recordedLinks(t, m); !maps.Equal(links, tt.wantLinks) {
+				t.Errorf("recorded links = %v, want %v", links, tt.wantLinks)
+			}
+		})
+	}
+}
+
+// Links created while watching are stored once, next to the copy the
+// repository already holds
+func TestLinksInBatch(t *testing.T) {
+	configDir, repoDir := t.TempDir(), t.TempDir()
+	for _, dir := range []string{configDir, repoDir} {
+		if err := os.WriteFile(filepath.Join(dir, "z.conf"), []byte("shared"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "other.conf"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"a.conf", "b.conf"} {
+		if err := os.Link(filepath.Join(configDir, "z.conf"), filepath.Join(configDir, link)); err != nil {
+			t.Skipf("hard links not supported: %v", err)
+		}
+	}
+
+	m := NewManager(configDir, repoDir, nil, nil, nil, time.Second, false, nil)
+	links := m.linksInBatch(map[string]bool{"a.conf": true, "b.conf": true, "other.conf": true})
+
+	want := map[string]string{"a.conf": "z.conf", "b.conf": "z.conf"}
+	if !maps.Equal(links, want) {
+		t.Errorf("linksInBatch = %v, want %v", links, want)
+	}
+}
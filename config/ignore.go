@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// IgnoreFile is the name of the gitignore-style files read from the config
+// directory, the repository and any of their subdirectories
+const IgnoreFile = ".configignore"
+
+// ignoreRule is a pattern read from an ignore file, with where it came from
+type ignoreRule struct {
+	pattern gitignore.Pattern
+	source  string // file:line
+	text    string
+}
+
+// LoadIgnoreFiles reads the ignore files of the repository and the config
+// directory. Patterns in the config directory take precedence, and patterns in
+// a subdirectory take precedence over those of its parents.
+func (m *Manager) LoadIgnoreFiles() error {
+	roots := []string{m.RepoDir, m.ConfigDir}
+	if m.InPlace {
+		// RepoDir is the git directory, which holds no ignore files
+		roots = roots[1:]
+	}
+
+	var rules []ignoreRule
+	for _, root := range roots {
+		var err error
+		if rules, err = m.readIgnoreRules(root, rules); err != nil {
+			return fmt.Errorf("failed to read %s files: %w", IgnoreFile, err)
+		}
+	}
+
+	m.ignoreRules = rules
+	return nil
+}
+
+// matchIgnoreRules returns the last ignore rule matching a path, which decides
+// whether it is ignored (Exclude) or re-included by a negated pattern (Include)
+func matchIgnoreRules(rules []ignoreRule, relPath string, isDir bool) (ignoreRule, gitignore.MatchResult) {
+	parts := splitPath(relPath)
+	for i := len(rules) - 1; i >= 0; i-- {
+		if result := rules[i].pattern.Match(parts, isDir); result != gitignore.NoMatch {
+			return rules[i], result
+		}
+	}
+	return ignoreRule{}, gitignore.NoMatch
+}
+
+// isGitPath reports whether a path is, or is inside, a .git directory
+func isGitPath(relPath string) bool {
+	for _, part := range splitPath(relPath) {
+		if part == ".git" {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath splits a relative path into its components
+func splitPath(relPath string) []string {
+	return strings.Split(filepath.ToSlash(filepath.Clean(relPath)), "/")
+}
+
+// readIgnoreRules appends the ignore files below root to rules. Like the
+// initial sync it only reads the directories that would be walked, judged by
+// the rules read so far.
+func (m *Manager) readIgnoreRules(root string, rules []ignoreRule) ([]ignoreRule, error) {
+	var walk func(dir []string) error
+	walk = func(dir []string) error {
+		dirPath := filepath.Join(append([]string{root}, dir...)...)
+
+		rs, err := readIgnoreFile(filepath.Join(dirPath, IgnoreFile), dir)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rs...)
+
+		entries, err := os.ReadDir(dirPath)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			child := append(append([]string{}, dir...), entry.Name())
+			if decision := m.decideWith(rules, filepath.Join(child...), true); !decision.Included && !decision.Descend {
+				continue
+			}
+
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(nil); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// readIgnoreFile parses a single ignore file. Patterns are relative to domain,
+// the directory holding the file.
+func readIgnoreFile(path string, domain []string) ([]ignoreRule, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules = append(rules, ignoreRule{
+			pattern: gitignore.ParsePattern(line, domain),
+			source:  fmt.Sprintf("%s:%d", path, lineNumber),
+			text:    line,
+		})
+	}
+
+	return rules, scanner.Err()
+}
+
+// isDirPath reports whether a path is a directory in the config directory or,
+// once it has been removed there, in the repository
+func (m *Manager) isDirPath(relPath string) bool {
+	if info, err := m.sourceInfo(relPath); err == nil {
+		return info.IsDir()
+	}
+	if info, err := os.Lstat(filepath.Join(m.RepoDir, relPath)); err == nil {
+		return info.IsDir()
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIgnoreFileAnchoringAndNegation(t *testing.T) {
+	configDir := t.TempDir()
+	ignoreFiles := map[string]string{
+		IgnoreFile:                         "*.log\n!keep.log\n/cache\nbuild/\n# comment\n",
+		filepath.Join("sub", IgnoreFile):   "/local.conf\n!debug.log\n",
+		filepath.Join("other", IgnoreFile): "!*.log\n*.bak\n",
+	}
+	for relPath, content := range ignoreFiles {
+		path := filepath.Join(configDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager(configDir, filepath.Join(t.TempDir(), "repo"), nil, nil, nil, time.Second, false, nil)
+	if err := m.LoadIgnoreFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		relPath  string
+		isDir    bool
+		included bool
+	}{
+		{"app.conf", false, true},
+		{"app.log", false, false},
+		{"sub/app.log", false, false},
+		{"keep.log", false, true},
+		{"sub/keep.log", false, true},
+		{"cache", true, false},
+		{"sub/cache", true, true},
+		{"build", true, false},
+		{"sub/build", true, false},
+		{"build", false, true},
+		{"local.conf", false, true},
+		{"sub/local.conf", false, false},
+		{"sub/deeper/local.conf", false, true},
+		{"sub/debug.log", false, true},
+		{"sub/deeper/debug.log", false, true},
+		{"debug.log", false, false},
+		{"other/app.log", false, true},
+		{"other/app.bak", false, false},
+		{"app.bak", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.relPath, func(t *testing.T) {
+			decision := m.decide(filepath.FromSlash(tt.relPath), tt.isDir)
+			if decision.Included != tt.included {
+				t.Errorf("decide(%s, dir=%v).Included = %v (%s), want %v", tt.relPath, tt.isDir, decision.Included, decision.Reason, tt.included)
+			}
+		})
+	}
+}
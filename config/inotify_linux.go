@@ -0,0 +1,80 @@
+//go:build linux
+
+package config
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// inotifyLimit reads fs.inotify.max_user_watches, the number of watches all
+// of a user's processes may hold together
+func inotifyLimit() (int, bool) {
+	content, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return 0, false
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	return limit, err == nil
+}
+
+// inotifyWatchesInUse counts the watches held by the current user's
+// processes, as listed in the fdinfo of their inotify instances
+func inotifyWatchesInUse() (int, bool) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, false
+	}
+
+	uid := uint32(os.Getuid())
+	count := 0
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+		info, err := proc.Info()
+		if err != nil {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != uid {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err != nil || target != "anon_inode:inotify" {
+				continue
+			}
+			count += countWatches(filepath.Join("/proc", proc.Name(), "fdinfo", fd.Name()))
+		}
+	}
+
+	return count, true
+}
+
+// countWatches counts the watches listed in an inotify instance's fdinfo
+func countWatches(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "inotify wd:") {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package config
+
+// inotifyLimit is only known on Linux; elsewhere the watch budget is unlimited
+func inotifyLimit() (int, bool) {
+	return 0, false
+}
+
+// inotifyWatchesInUse is only known on Linux
+func inotifyWatchesInUse() (int, bool) {
+	return 0, false
+}
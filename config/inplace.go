@@ -0,0 +1,362 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"config_handler/ui"
+)
+
+// In in-place mode the git work tree is the config directory itself and
+// RepoDir only holds the git directory. Nothing is copied: the include and
+// exclude rules decide which files are staged, and restores are read from the
+// last commit. Links are always stored as links, and there is no trash or
+// permission manifest, since the files never leave their place.
+
+// initialSyncInPlace stages the included files and the deletions made while
+// we were not running, and commits them
+func (m *Manager) initialSyncInPlace() error {
+	if err := m.checkSourceAvailable(); err != nil {
+		if errors.Is(err, os.ErrNotExist) || !m.Interactive || !m.confirmUnsafeSync(err.Error()) {
+			return fmt.Errorf("refusing to sync: %w", err)
+		}
+	}
+
+	tracked, err := m.trackedSet()
+	if err != nil {
+		return fmt.Errorf("failed to list tracked files: %w", err)
+	}
+
+	var staged []string
+	added := 0
+	skipped := &skipReport{}
+	err = m.walkConfig(m.ConfigDir, skipped, func(relPath, path string, info os.FileInfo) error {
+		if info.IsDir() {
+			if !m.shouldWalk(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !m.shouldInclude(relPath, false) {
+			return nil
+		}
+
+		staged = append(staged, relPath)
+		if !tracked[relPath] {
+			added++
+			if added <= 10 || m.Verbose {
+				ui.PrintFileOperation("added", relPath)
+			} else if added == 11 && !m.Verbose {
+				ui.PrintInfo("... and more files")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync config files: %w", err)
+	}
+
+	skipped.print(m.Verbose)
+
+	// Stop tracking files that were deleted while we were not running
+	deletedFiles, err := m.findDeletedFiles()
+	if err != nil {
+		return fmt.Errorf("failed to reconcile deleted files: %w", err)
+	}
+
+	if limitErr := m.checkDeletionLimit(len(deletedFiles)); limitErr != nil && !m.confirmUnsafeSync(limitErr.Error()) {
+		ui.PrintWarning(fmt.Sprintf("Keeping %d deleted files in the repository", len(deletedFiles)))
+		m.heldAtStart, deletedFiles = deletedFiles, nil
+	}
+	for _, relPath := range deletedFiles {
+		ui.PrintFileOperation("deleted", relPath)
+	}
+	staged = append(staged, deletedFiles...)
+
+	ui.PrintInfo(fmt.Sprintf("Tracking %d files in place (%d new)", len(staged)-len(deletedFiles), added))
+	if len(deletedFiles) > 0 {
+		ui.PrintInfo(fmt.Sprintf("Removed %d files deleted from the configuration directory", len(deletedFiles)))
+	}
+	ui.PrintInfo("Committing changes to repository...")
+
+	if err := m.GitRepo.Stage(staged...); err != nil {
+		return fmt.Errorf("failed to stage files: %w", err)
+	}
+
+	commitMsg := "Initial sync of configuration files"
+	if len(deletedFiles) > 0 {
+		commitMsg += "; deleted: " + summarizeFileList(strings.Join(deletedFiles, ", "))
+	}
+
+	if err := m.GitRepo.SyncWithRemote(commitMsg); err != nil {
+		return fmt.Errorf("failed to sync with remote: %w", err)
+	}
+
+	return nil
+}
+
+// syncChangedFilesInPlace stages a batch of changed files and commits them
+func (m *Manager) syncChangedFilesInPlace(changedFiles map[string]bool) {
+	tracked, err := m.trackedSet()
+	if err != nil {
+		ui.PrintError("Failed to list tracked files: " + err.Error())
+		return
+	}
+
+	fileChangeSummary := make(map[string]string)
+	fileChanges := make(map[string][]string)
+	var staged []string
+	record := func(operation, relPath string) {
+		staged = append(staged, relPath)
+		fileChanges[operation] = append(fileChanges[operation], relPath)
+		fileChangeSummary[operation] = fileChangeSummary[operation] + relPath + ", "
+	}
+
+	// Renamed files are staged as a pair
+	renamed := make(map[string]bool)
+	renames := m.detectRenames(changedFiles, func(relPath string) bool { return tracked[relPath] })
+	for newPath, oldPath := range renames {
+		label := renameLabel(oldPath, newPath)
+		renamed[oldPath], renamed[newPath] = true, true
+		staged = append(staged, oldPath, newPath)
+		fileChanges["renamed"] = append(fileChanges["renamed"], label)
+		fileChangeSummary["renamed"] = fileChangeSummary["renamed"] + label + ", "
+	}
+
+	for relPath := range changedFiles {
+		if renamed[relPath] {
+			continue
+		}
+
+		info, err := m.sourceInfo(relPath)
+		switch {
+		case errors.Is(err, errSymlinkSkipped):
+			continue
+		case err == nil && info.IsDir():
+			// Git tracks the files below, which have events of their own
+			continue
+		case err == nil && specialFileKind(info.Mode()) != "":
+			if m.Verbose {
+				ui.PrintInfo(fmt.Sprintf("Skipping %s %s", specialFileKind(info.Mode()), relPath))
+			}
+			continue
+		case err == nil && tracked[relPath]:
+			record("modified", relPath)
+		case err == nil:
+			record("added", relPath)
+		case os.IsNotExist(err):
+			// A deleted directory takes the tracked files below it along
+			prefix := relPath + string(filepath.Separator)
+			for file := range tracked {
+				if file == relPath || strings.HasPrefix(file, prefix) {
+					record("deleted", file)
+				}
+			}
+		}
+	}
+
+	if len(staged) == 0 {
+		return
+	}
+
+	if err := m.GitRepo.Stage(staged...); err != nil {
+		ui.PrintError("Failed to stage changes: " + err.Error())
+		return
+	}
+
+	m.publishChanges(fileChanges, fileChangeSummary, len(staged))
+}
+
+// trackInPlace stages the included files at or below relPath
+func (m *Manager) trackInPlace(relPath string) ([]string, error) {
+	rootPath := filepath.Join(m.ConfigDir, relPath)
+	if _, err := os.Lstat(rootPath); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err := m.walkConfig(rootPath, nil, func(relPath, path string, info os.FileInfo) error {
+		if info.IsDir() {
+			if !m.shouldWalk(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if m.shouldInclude(relPath, false) {
+			files = append(files, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, m.GitRepo.Stage(files...)
+}
+
+// untrackInPlace removes the tracked files at or below relPath from the
+// index, leaving them in the config directory
+func (m *Manager) untrackInPlace(relPath string) ([]string, error) {
+	files, err := m.trackedBelow(relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return files, m.GitRepo.Unstage(files...)
+}
+
+// restoreInPlace writes the last committed version of the tracked files at
+// or below relPath into the config directory
+func (m *Manager) restoreInPlace(relPath string, overwrite bool) (*RestoreSummary, error) {
+	summary := &RestoreSummary{}
+
+	files, err := m.trackedBelow(relPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s is not tracked: %w", relPath, os.ErrNotExist)
+	}
+
+	for _, file := range files {
+		if !m.shouldInclude(file, false) {
+			continue
+		}
+
+		reader, mode, err := m.GitRepo.HeadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			// Staged but not committed yet
+			continue
+		} else if err != nil {
+			return summary, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return summary, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		path := filepath.Join(m.ConfigDir, file)
+		if same, exists := sameAsCommitted(path, content, mode); same {
+			summary.Unchanged = append(summary.Unchanged, file)
+			continue
+		} else if exists && !overwrite {
+			summary.Conflicts = append(summary.Conflicts, file)
+			continue
+		}
+
+		if err := writeCommitted(path, content, mode); err != nil {
+			return summary, fmt.Errorf("failed to restore %s: %w", file, err)
+		}
+		summary.Restored = append(summary.Restored, file)
+	}
+
+	return summary, nil
+}
+
+// findUntrackedFiles returns included files that aren't in the index yet,
+// such as those covered by a new include pattern
+func (m *Manager) findUntrackedFiles() (map[string]bool, error) {
+	tracked, err := m.trackedSet()
+	if err != nil {
+		return nil, err
+	}
+
+	untracked := make(map[string]bool)
+	err = m.walkConfig(m.ConfigDir, nil, func(relPath, path string, info os.FileInfo) error {
+		if info.IsDir() {
+			if !m.shouldWalk(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if m.shouldInclude(relPath, false) && !tracked[relPath] {
+			untracked[relPath] = true
+		}
+		return nil
+	})
+
+	return untracked, err
+}
+
+// trackedSet returns the tracked files as a set
+func (m *Manager) trackedSet() (map[string]bool, error) {
+	files, err := m.trackedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool, len(files))
+	for _, file := range files {
+		tracked[file] = true
+	}
+	return tracked, nil
+}
+
+// trackedBelow returns the tracked files at or below relPath, sorted
+func (m *Manager) trackedBelow(relPath string) ([]string, error) {
+	tracked, err := m.trackedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	relPath = filepath.Clean(relPath)
+	prefix := relPath + string(filepath.Separator)
+
+	var files []string
+	for _, file := range tracked {
+		if relPath == "." || file == relPath || strings.HasPrefix(file, prefix) {
+			files = append(files, file)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// sameAsCommitted reports whether the file at path matches the committed
+// content, and whether anything exists at path at all
+func sameAsCommitted(path string, content []byte, mode os.FileMode) (bool, bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, false
+	}
+
+	if mode&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		return err == nil && target == string(content), true
+	}
+
+	if !info.Mode().IsRegular() {
+		return false, true
+	}
+
+	local, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(local, content), true
+}
+
+// writeCommitted replaces path with committed content, a file or a link
+func writeCommitted(path string, content []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if mode&os.ModeSymlink != 0 {
+		return os.Symlink(string(content), path)
+	}
+
+	if err := os.WriteFile(path, content, mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode.Perm())
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+)
+
+// ManifestFile is the name of the permission manifest each root keeps at the
+// top of its directory of the repository (RepoDir)
+const ManifestFile = ".config_manifest.json"
+
+// ManifestEntry records the metadata git cannot store for a single path
+type ManifestEntry struct {
+	Mode  string `json:"mode,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Hardlink is the path of another synced file this one is a hard link to.
+	// Only that path is stored in the repository.
+	Hardlink string `json:"hardlink,omitempty"`
+}
+
+// Manifest maps repository paths (slash separated) to their recorded metadata
+type Manifest struct {
+	Entries map[string]ManifestEntry `json:"entries"`
+
+	dirty   bool
+	modTime time.Time // Of the file when it was read or written, zero if missing
+}
+
+// secretPatterns match file names that usually hold credentials
+var secretPatterns = []glob.Glob{
+	glob.MustCompile("id_{rsa,dsa,ecdsa,ed25519}"),
+	glob.MustCompile("*.{pem,key,p12,pfx,kdbx}"),
+	glob.MustCompile("*{secret,token,password,passwd,credential}*"),
+	glob.MustCompile("{.netrc,.pgpass,.env,hosts.yml,auth.json}"),
+}
+
+// isInternalFile reports whether a repository path is bookkeeping written by
+// the config handler rather than a synced configuration file
+func isInternalFile(relPath string) bool {
+	return relPath == ManifestFile
+}
+
+// looksSecret reports whether a file name suggests it holds credentials
+func looksSecret(relPath string) bool {
+	name := strings.ToLower(filepath.Base(relPath))
+	for _, pattern := range secretPatterns {
+		if pattern.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadManifest reads the manifest from the repository, starting an empty one
+// if it doesn't exist yet. The copy read before is used until the file
+// changes, which happens when a command such as track runs alongside, unless
+// it holds changes that weren't saved yet.
+func (m *Manager) loadManifest() (*Manifest, error) {
+	manifestPath := filepath.Join(m.RepoDir, ManifestFile)
+	modTime := manifestModTime(manifestPath)
+	if m.manifest != nil && (m.manifest.dirty || m.manifest.modTime.Equal(modTime)) {
+		return m.manifest, nil
+	}
+
+	manifest := &Manifest{Entries: make(map[string]ManifestEntry), modTime: modTime}
+
+	content, err := os.ReadFile(manifestPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	} else if err == nil {
+		if err := json.Unmarshal(content, manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if manifest.Entries == nil {
+			manifest.Entries = make(map[string]ManifestEntry)
+		}
+	}
+
+	m.manifest = manifest
+	return manifest, nil
+}
+
+// recordMetadata stores the mode (and optionally ownership) of a synced path
+func (m *Manager) recordMetadata(relPath string, info os.FileInfo) {
+	// The mode of a symbolic link is meaningless
+	if info.Mode()&os.ModeSymlink != 0 {
+		return
+	}
+
+	manifest, err := m.loadManifest()
+	if err != nil {
+		return
+	}
+
+	entry := ManifestEntry{Mode: formatMode(info.Mode())}
+	if m.RecordOwnership {
+		entry.Owner, entry.Group = fileOwnerNames(info)
+	}
+
+	key := filepath.ToSlash(relPath)
+	if manifest.Entries[key] != entry {
+		manifest.Entries[key] = entry
+		manifest.dirty = true
+	}
+}
+
+// forgetMetadata drops the manifest entries of a removed path and everything below it
+func (m *Manager) forgetMetadata(relPath string) {
+	manifest, err := m.loadManifest()
+	if err != nil {
+		return
+	}
+
+	key := filepath.ToSlash(relPath)
+	for path := range manifest.Entries {
+		if path == key || strings.HasPrefix(path, key+"/") {
+			delete(manifest.Entries, path)
+			manifest.dirty = true
+		}
+	}
+}
+
+// pruneManifest drops entries for paths that no longer exist in the repository,
+// and hard link records whose link or first path is gone
+func (m *Manager) pruneManifest() {
+	manifest, err := m.loadManifest()
+	if err != nil {
+		return
+	}
+
+	for path, entry := range manifest.Entries {
+		if entry.Hardlink != "" {
+			_, errLink := os.Lstat(filepath.Join(m.ConfigDir, filepath.FromSlash(path)))
+			_, errPrimary := os.Lstat(filepath.Join(m.RepoDir, filepath.FromSlash(entry.Hardlink)))
+			if errLink != nil || errPrimary != nil {
+				delete(manifest.Entries, path)
+				manifest.dirty = true
+			}
+			continue
+		}
+
+		if _, err := os.Lstat(filepath.Join(m.RepoDir, filepath.FromSlash(path))); os.IsNotExist(err) {
+			delete(manifest.Entries, path)
+			manifest.dirty = true
+		}
+	}
+}
+
+// saveManifest writes the manifest to the repository if it changed
+func (m *Manager) saveManifest() error {
+	if m.InPlace || m.manifest == nil || !m.manifest.dirty {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(m.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	manifestPath := filepath.Join(m.RepoDir, ManifestFile)
+	tempPath := manifestPath + ".tmp"
+	if err := os.WriteFile(tempPath, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := os.Rename(tempPath, manifestPath); err != nil {
+		return fmt.Errorf("failed to replace manifest: %w", err)
+	}
+
+	m.manifest.dirty = false
+	m.manifest.modTime = manifestModTime(manifestPath)
+	return nil
+}
+
+// manifestModTime returns when the manifest file was last written, or the
+// zero time if it doesn't exist
+func manifestModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// applyMetadata re-applies the recorded mode and ownership to a restored path.
+// It returns warnings for ownership that couldn't be restored and for
+// secret-looking files that end up world-readable.
+func (m *Manager) applyMetadata(relPath, targetPath string) ([]string, error) {
+	manifest, err := m.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	entry, ok := manifest.Entries[filepath.ToSlash(relPath)]
+	if ok {
+		mode, err := parseMode(entry.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode for %s: %w", relPath, err)
+		}
+
+		if err := os.Chmod(targetPath, mode); err != nil {
+			return nil, err
+		}
+
+		if entry.Owner != "" || entry.Group != "" {
+			if err := chownByName(targetPath, entry.Owner, entry.Group); err != nil {
+				warnings = append(warnings, fmt.Sprintf("could not restore ownership %s:%s of %s: %v", entry.Owner, entry.Group, relPath, err))
+			}
+		}
+	}
+
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		return warnings, err
+	}
+
+	if !info.IsDir() && info.Mode().Perm()&0004 != 0 && looksSecret(relPath) {
+		warnings = append(warnings, fmt.Sprintf("%s looks like a secret but is world-readable (%s)", relPath, formatMode(info.Mode())))
+	}
+
+	return warnings, nil
+}
+
+// formatMode renders permission bits, including setuid, setgid and sticky, as octal
+func formatMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// parseMode converts an octal mode string from the manifest back to a FileMode
+func parseMode(value string) (os.FileMode, error) {
+	bits, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	mode := os.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// fileOwnerNames returns the user and group names owning a file, falling back
+// to numeric IDs when they can't be resolved
+func fileOwnerNames(info os.FileInfo) (string, string) {
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return "", ""
+	}
+
+	owner := strconv.Itoa(uid)
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+
+	group := strconv.Itoa(gid)
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+
+	return owner, group
+}
+
+// chownByName changes the ownership of a path to the named user and group
+func chownByName(path, owner, group string) error {
+	uid, gid := -1, -1
+
+	if owner != "" {
+		if u, err := user.Lookup(owner); err == nil {
+			uid, _ = strconv.Atoi(u.Uid)
+		} else if id, err := strconv.Atoi(owner); err == nil {
+			uid = id
+		}
+	}
+
+	if group != "" {
+		if g, err := user.LookupGroup(group); err == nil {
+			gid, _ = strconv.Atoi(g.Gid)
+		} else if id, err := strconv.Atoi(group); err == nil {
+			gid = id
+		}
+	}
+
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+
+	return os.Lchown(path, uid, gid)
+}
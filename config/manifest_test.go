@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestModeRoundTrip(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		text string
+	}{
+		{0644, "0644"},
+		{0600, "0600"},
+		{0755, "0755"},
+		{0, "0000"},
+		{0755 | os.ModeSetuid, "4755"},
+		{0755 | os.ModeSetgid, "2755"},
+		{0777 | os.ModeSticky, "1777"},
+		{0750 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky, "7750"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := formatMode(tt.mode); got != tt.text {
+				t.Errorf("formatMode(%v) = %q, want %q", tt.mode, got, tt.text)
+			}
+
+			mode, err := parseMode(tt.text)
+			if err != nil {
+				t.Fatalf("parseMode(%q) failed: %v", tt.text, err)
+			}
+			if mode != tt.mode {
+				t.Errorf("parseMode(%q) = %v, want %v", tt.text, mode, tt.mode)
+			}
+		})
+	}
+}
+
+// Only the permission and special bits are stored, not the file type
+func TestFormatModeDropsFileType(t *testing.T) {
+	if got := formatMode(os.ModeDir | 0700); got != "0700" {
+		t.Errorf("formatMode(dir 0700) = %q, want %q", got, "0700")
+	}
+}
+
+func TestParseModeRejectsInvalid(t *testing.T) {
+	for _, value := range []string{"", "rw-r--r--", "0899", "-644"} {
+		if _, err := parseMode(value); err == nil {
+			t.Errorf("parseMode(%q) succeeded, want an error", value)
+		}
+	}
+}
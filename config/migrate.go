@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"config_handler/ui"
+)
+
+// MovePrefix moves the manager's files in the repository from RepoPrefix to
+// another directory of the repository, together with the manifest and the
+// trash entries, and returns the moved entries. Nothing is moved if any entry
+// would overwrite an existing path, and a failure part way moves the entries
+// back, so the files are never left split between the two directories.
+func (m *Manager) MovePrefix(prefix string) ([]string, error) {
+	prefix = filepath.Clean(prefix)
+	if prefix == "." {
+		prefix = ""
+	}
+	if prefix == m.RepoPrefix {
+		return nil, fmt.Errorf("the files are already stored in %s", DescribePrefix(prefix))
+	}
+
+	oldDir, newDir := m.RepoDir, filepath.Join(m.repoRoot, prefix)
+
+	entries, err := os.ReadDir(oldDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(oldDir, name)
+
+		// Leave git metadata, the new location and other roots where they are
+		if name == ".git" || path == newDir || strings.HasPrefix(newDir, path+string(filepath.Separator)) {
+			continue
+		}
+		if root, inside := m.otherRootAt(path); root != nil {
+			if !inside {
+				continue
+			}
+			return nil, fmt.Errorf("%s can't be moved because it holds the root %s", name, root.Source)
+		}
+
+		if _, err := os.Lstat(filepath.Join(newDir, name)); err == nil {
+			return nil, fmt.Errorf("%s already exists in %s", name, DescribePrefix(prefix))
+		}
+		names = append(names, name)
+	}
+
+	if err := os.MkdirAll(newDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", newDir, err)
+	}
+
+	var moved []string
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(oldDir, name), filepath.Join(newDir, name)); err != nil {
+			m.moveBack(moved, newDir, oldDir)
+			return nil, fmt.Errorf("failed to move %s: %w", name, err)
+		}
+		moved = append(moved, name)
+	}
+
+	// Trashed files keep their place in the trash under the new paths
+	if err := m.renameTrashPrefix(prefix); err != nil {
+		m.moveBack(moved, newDir, oldDir)
+		return nil, fmt.Errorf("failed to update trash: %w", err)
+	}
+
+	pruneEmptyDirs(oldDir, m.repoRoot)
+	m.SetRoot(m.repoRoot, prefix, m.otherRoots)
+	return moved, nil
+}
+
+// renameTrashPrefix moves the trash entries of this root to another prefix
+func (m *Manager) renameTrashPrefix(prefix string) error {
+	if m.State == nil {
+		return nil
+	}
+
+	items, err := m.TrashEntries()
+	if err != nil {
+		return err
+	}
+
+	renames := make(map[string]string, len(items))
+	for _, item := range items {
+		renames[m.repoPath(item.Path)] = filepath.Join(prefix, item.Path)
+	}
+	return m.State.RenameInTrash(renames)
+}
+
+// moveBack undoes the moves of a failed MovePrefix, reporting entries that
+// can't be moved back
+func (m *Manager) moveBack(names []string, from, to string) {
+	for i := len(names) - 1; i >= 0; i-- {
+		if err := os.Rename(filepath.Join(from, names[i]), filepath.Join(to, names[i])); err != nil {
+			ui.PrintError(fmt.Sprintf("Failed to move %s back to %s: %v", names[i], to, err))
+		}
+	}
+	pruneEmptyDirs(from, m.repoRoot)
+}
+
+// otherRootAt returns the other root whose repository directory is path, or
+// is inside path (inside is then set)
+func (m *Manager) otherRootAt(path string) (*Root, bool) {
+	for i, root := range m.otherRoots {
+		rootDir := filepath.Join(m.repoRoot, root.Prefix)
+		if rootDir == path {
+			return &m.otherRoots[i], false
+		}
+		if strings.HasPrefix(rootDir, path+string(filepath.Separator)) {
+			return &m.otherRoots[i], true
+		}
+	}
+	return nil, false
+}
+
+// DescribePrefix names a directory of the repository for messages
+func DescribePrefix(prefix string) string {
+	if prefix == "" {
+		return "the top level of the repository"
+	}
+	return filepath.ToSlash(filepath.Clean(prefix)) + "/"
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// entryState is what the polling watcher compares between scans
+type entryState struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+}
+
+// pollingWatcher reports changes by comparing directory listings at an
+// interval, for file systems that don't deliver inotify events such as NFS,
+// SMB and many FUSE mounts. Renames show up as a removal and a creation.
+type pollingWatcher struct {
+	interval time.Duration
+	events   chan fsnotify.Event
+	errors   chan error
+	done     chan struct{}
+	close    sync.Once
+
+	mu   sync.Mutex
+	dirs map[string]map[string]entryState
+}
+
+// newPollingWatcher creates a polling watcher and starts scanning
+func newPollingWatcher(interval time.Duration) *pollingWatcher {
+	p := &pollingWatcher{
+		interval: interval,
+		events:   make(chan fsnotify.Event),
+		errors:   make(chan error),
+		done:     make(chan struct{}),
+		dirs:     make(map[string]map[string]entryState),
+	}
+	go p.run()
+	return p
+}
+
+// Add watches a directory; entries already in it are not reported
+func (p *pollingWatcher) Add(path string) error {
+	entries, err := snapshotDir(path)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.dirs[path] = entries
+	p.mu.Unlock()
+	return nil
+}
+
+// Remove stops watching a directory
+func (p *pollingWatcher) Remove(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.dirs[path]; !ok {
+		return fmt.Errorf("%w: %s", fsnotify.ErrNonExistentWatch, path)
+	}
+	delete(p.dirs, path)
+	return nil
+}
+
+// WatchList returns the watched directories
+func (p *pollingWatcher) WatchList() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func (p *pollingWatcher) Events() <-chan fsnotify.Event { return p.events }
+func (p *pollingWatcher) Errors() <-chan error          { return p.errors }
+func (p *pollingWatcher) Name() string                  { return "poll" }
+func (p *pollingWatcher) Usage() (int, int)             { return 0, len(p.WatchList()) }
+
+// Close stops scanning and closes the event and error channels
+func (p *pollingWatcher) Close() error {
+	p.close.Do(func() { close(p.done) })
+	return nil
+}
+
+// run scans the watched directories until the watcher is closed
+func (p *pollingWatcher) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	defer close(p.errors)
+	defer close(p.events)
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			if !p.poll() {
+				return
+			}
+		}
+	}
+}
+
+// poll scans each watched directory once and reports the differences to the
+// previous scan. It returns false once the watcher is closed.
+func (p *pollingWatcher) poll() bool {
+	for _, dir := range p.WatchList() {
+		current, err := snapshotDir(dir)
+		if os.IsNotExist(err) {
+			// The parent directory reports the removal, as with inotify
+			p.Remove(dir)
+			continue
+		} else if err != nil {
+			if !p.send(nil, err) {
+				return false
+			}
+			continue
+		}
+
+		p.mu.Lock()
+		previous, ok := p.dirs[dir]
+		if ok {
+			p.dirs[dir] = current
+		}
+		p.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		for name, state := range current {
+			var op fsnotify.Op
+			old, existed := previous[name]
+			switch {
+			case !existed:
+				op = fsnotify.Create
+			case old.isDir != state.isDir:
+				if !p.send(&fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove}, nil) {
+					return false
+				}
+				op = fsnotify.Create
+			case state.isDir:
+				// Directories change with their entries, which report themselves
+				continue
+			case old.size != state.size || !old.modTime.Equal(state.modTime):
+				op = fsnotify.Write
+			case old.mode != state.mode:
+				op = fsnotify.Chmod
+			default:
+				continue
+			}
+
+			if !p.send(&fsnotify.Event{Name: filepath.Join(dir, name), Op: op}, nil) {
+				return false
+			}
+		}
+
+		for name := range previous {
+			if _, ok := current[name]; !ok {
+				if !p.send(&fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove}, nil) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+// send delivers an event or an error, returning false once the watcher is closed
+func (p *pollingWatcher) send(event *fsnotify.Event, err error) bool {
+	if event != nil {
+		select {
+		case p.events <- *event:
+			return true
+		case <-p.done:
+			return false
+		}
+	}
+
+	select {
+	case p.errors <- err:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// snapshotDir records the state of a directory's entries
+func snapshotDir(path string) (map[string]entryState, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]entryState, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since the listing was read
+			continue
+		}
+		states[entry.Name()] = entryState{
+			isDir:   info.IsDir(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			mode:    info.Mode(),
+		}
+	}
+	return states, nil
+}
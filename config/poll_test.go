@@ -0,0 +1,167 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// pollEvents runs one scan and returns the events it reports as "op name"
+func pollEvents(t *testing.T, p *pollingWatcher, dir string) []string {
+	t.Helper()
+
+	done := make(chan bool)
+	go func() { done <- p.poll() }()
+
+	var events []string
+	for {
+		select {
+		case event := <-p.events:
+			relPath, err := filepath.Rel(dir, event.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, event.Op.String()+" "+filepath.ToSlash(relPath))
+		case err := <-p.errors:
+			t.Errorf("poll error: %v", err)
+		case <-done:
+			slices.Sort(events)
+			return events
+		}
+	}
+}
+
+func TestPollingWatcherEvents(t *testing.T) {
+	write := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string)
+		want   []string
+	}{
+		{
+			name:   "nothing changed",
+			change: func(t *testing.T, dir string) {},
+		},
+		{
+			name:   "file created",
+			change: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "new.conf"), "new") },
+			want:   []string{"CREATE new.conf"},
+		},
+		{
+			name:   "file modified",
+			change: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.conf"), "changed contents") },
+			want:   []string{"WRITE app.conf"},
+		},
+		{
+			name: "file deleted",
+			change: func(t *testing.T, dir string) {
+				if err := os.Remove(filepath.Join(dir, "app.conf")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"REMOVE app.conf"},
+		},
+		{
+			name: "mode changed",
+			change: func(t *testing.T, dir string) {
+				if err := os.Chmod(filepath.Join(dir, "app.conf"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"CHMOD app.conf"},
+		},
+		{
+			name: "file replaced by a directory",
+			change: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, "app.conf")
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Mkdir(path, 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"CREATE app.conf", "REMOVE app.conf"},
+		},
+		{
+			name: "file renamed",
+			change: func(t *testing.T, dir string) {
+				if err := os.Rename(filepath.Join(dir, "app.conf"), filepath.Join(dir, "renamed.conf")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"CREATE renamed.conf", "REMOVE app.conf"},
+		},
+		{
+			name: "file written in a subdirectory",
+			change: func(t *testing.T, dir string) {
+				write(t, filepath.Join(dir, "sub", "inner.conf"), "inner")
+			},
+			want: []string{"CREATE sub/inner.conf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			write(t, filepath.Join(dir, "app.conf"), "contents")
+			if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			// The interval is long enough that only the test scans
+			p := newPollingWatcher(time.Hour)
+			defer p.Close()
+			for _, watched := range []string{dir, filepath.Join(dir, "sub")} {
+				if err := p.Add(watched); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tt.change(t, dir)
+			if got := pollEvents(t, p, dir); !slices.Equal(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A removed directory stops being scanned; its parent reports the removal
+func TestPollingWatcherDropsRemovedDirectories(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newPollingWatcher(time.Hour)
+	defer p.Close()
+	for _, watched := range []string{dir, sub} {
+		if err := p.Add(watched); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Remove(sub); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pollEvents(t, p, dir), []string{"REMOVE sub"}; !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if watched := p.WatchList(); !slices.Equal(watched, []string{dir}) {
+		t.Errorf("watched = %v, want only %s", watched, dir)
+	}
+	if err := p.Remove(sub); err == nil {
+		t.Errorf("removing %s again succeeded, want %v", sub, fsnotify.ErrNonExistentWatch)
+	}
+}
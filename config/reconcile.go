@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"config_handler/ui"
+)
+
+// findDeletedFiles returns files tracked in the repository that no longer exist
+// in the config directory but still match the include rules
+func (m *Manager) findDeletedFiles() ([]string, error) {
+	trackedFiles, err := m.trackedFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tracked files: %w", err)
+	}
+
+	var deleted []string
+	for _, relPath := range trackedFiles {
+		if isInternalFile(relPath) || !m.shouldInclude(relPath, false) {
+			continue
+		}
+
+		if _, err := os.Lstat(filepath.Join(m.ConfigDir, relPath)); os.IsNotExist(err) {
+			deleted = append(deleted, relPath)
+		}
+	}
+
+	sort.Strings(deleted)
+	return deleted, nil
+}
+
+// removeDeletedFiles removes files from the repository that were deleted from
+// the config directory while the watcher was not running
+func (m *Manager) removeDeletedFiles(deletedFiles []string) []string {
+	removed := make([]string, 0, len(deletedFiles))
+	for _, relPath := range deletedFiles {
+		err := m.removeFromRepo(relPath)
+		if err != nil {
+			ui.PrintError("Failed to remove file " + relPath + ": " + err.Error())
+			continue
+		}
+
+		removed = append(removed, relPath)
+		if len(removed) <= 10 || m.Verbose {
+			ui.PrintFileOperation("deleted", relPath)
+		} else if len(removed) == 11 && !m.Verbose {
+			ui.PrintInfo("... and more deleted files")
+		}
+	}
+
+	return removed
+}
+
+// removeFromRepo removes a file from the repository and prunes any parent
+// directories left empty by the removal
+func (m *Manager) removeFromRepo(relPath string) error {
+	targetPath := filepath.Join(m.RepoDir, relPath)
+
+	err := os.Remove(targetPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	m.forgetMetadata(relPath)
+	pruneEmptyDirs(filepath.Dir(targetPath), m.RepoDir)
+	return nil
+}
+
+// pruneEmptyDirs removes empty directories from dir upwards, stopping at root
+func pruneEmptyDirs(dir, root string) {
+	for dir != root && len(dir) > len(root) {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"config_handler/ui"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchConfigFile watches the directory holding the config file, so that
+// editors replacing the file instead of writing it are noticed too
+func (m *Manager) watchConfigFile() (*fsnotify.Watcher, string, error) {
+	configFile, err := filepath.Abs(m.ConfigFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+		watcher.Close()
+		return nil, "", err
+	}
+
+	return watcher, configFile, nil
+}
+
+// reloadConfig loads the config file again and applies the new rules and
+// settings. It returns included files that aren't up to date in the
+// repository, such as those covered by a new include pattern.
+func (m *Manager) reloadConfig() map[string]bool {
+	next, err := m.LoadConfig()
+	if err != nil {
+		ui.PrintError("Failed to reload " + m.ConfigFile + ", keeping the current configuration: " + err.Error())
+		return nil
+	}
+
+	changes := m.applyConfig(next)
+	added, removed := m.updateWatches()
+	if len(changes) == 0 && len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	ui.PrintSection("Configuration Reloaded")
+	for _, change := range changes {
+		ui.PrintInfo(change)
+	}
+	for _, dir := range added {
+		ui.PrintFileOperation("added", "watch: "+dir)
+	}
+	for _, dir := range removed {
+		ui.PrintFileOperation("deleted", "watch: "+dir)
+	}
+
+	unsynced, err := m.findUnsyncedFiles()
+	if err != nil {
+		ui.PrintError("Failed to reconcile after reload: " + err.Error())
+		return nil
+	}
+	if len(unsynced) > 0 {
+		ui.PrintInfo(fmt.Sprintf("%d files need syncing under the new rules", len(unsynced)))
+	}
+
+	return unsynced
+}
+
+// applyConfig copies the rules and settings of next, a manager built from the
+// reloaded config file, and describes what changed
+func (m *Manager) applyConfig(next *Manager) []string {
+	var changes []string
+	describe := func(name string, old, new any) {
+		changes = append(changes, fmt.Sprintf("%s: %v → %v", name, old, new))
+	}
+
+	if !slices.Equal(next.includePatterns, m.includePatterns) {
+		describe("include", formatPatterns(m.includePatterns), formatPatterns(next.includePatterns))
+	}
+	if !slices.Equal(next.excludePatterns, m.excludePatterns) {
+		describe("exclude", formatPatterns(m.excludePatterns), formatPatterns(next.excludePatterns))
+	}
+	if next.MaintenanceInterval != m.MaintenanceInterval {
+		describe("maintenance_interval", m.MaintenanceInterval, next.MaintenanceInterval)
+	}
+	if next.QuietPeriod != m.QuietPeriod {
+		describe("quiet_period", m.QuietPeriod, next.QuietPeriod)
+	}
+	if next.MaxLatency != m.MaxLatency {
+		describe("max_latency", m.MaxLatency, next.MaxLatency)
+	}
+	if next.StormThreshold != m.StormThreshold {
+		describe("storm_threshold", m.StormThreshold, next.StormThreshold)
+	}
+	if next.StormWindow != m.StormWindow {
+		describe("storm_window", m.StormWindow, next.StormWindow)
+	}
+	if next.RescanInterval != m.RescanInterval {
+		describe("rescan_interval", m.RescanInterval, next.RescanInterval)
+	}
+	if next.MaxDeletePercent != m.MaxDeletePercent {
+		describe("max_delete_percent", m.MaxDeletePercent, next.MaxDeletePercent)
+	}
+	if next.TrashGracePeriod != m.TrashGracePeriod {
+		describe("trash_grace_period", m.TrashGracePeriod, next.TrashGracePeriod)
+	}
+	if next.PreserveXattrs != m.PreserveXattrs {
+		describe("preserve_xattrs", m.PreserveXattrs, next.PreserveXattrs)
+	}
+	if next.RecordOwnership != m.RecordOwnership {
+		describe("manifest_ownership", m.RecordOwnership, next.RecordOwnership)
+	}
+	if next.SymlinkPolicy != m.SymlinkPolicy || !slices.Equal(next.symlinkSources, m.symlinkSources) {
+		changes = append(changes, "symlink policies changed")
+	}
+	if next.Verbose != m.Verbose {
+		describe("verbose", m.Verbose, next.Verbose)
+	}
+
+	m.IncludeGlobs, m.includePatterns = next.IncludeGlobs, next.includePatterns
+	m.ExcludeGlobs, m.excludePatterns = next.ExcludeGlobs, next.excludePatterns
+	m.MaintenanceInterval = next.MaintenanceInterval
+	m.QuietPeriod, m.MaxLatency = next.QuietPeriod, next.MaxLatency
+	m.StormThreshold, m.StormWindow = next.StormThreshold, next.StormWindow
+	m.RescanInterval = next.RescanInterval
+	m.MaxDeletePercent = next.MaxDeletePercent
+	m.TrashGracePeriod = next.TrashGracePeriod
+	m.PreserveXattrs = next.PreserveXattrs
+	m.RecordOwnership = next.RecordOwnership
+	m.SymlinkPolicy, m.symlinkRules, m.symlinkSources = next.SymlinkPolicy, next.symlinkRules, next.symlinkSources
+	m.ignoreRules = next.ignoreRules
+	m.Verbose = next.Verbose
+
+	return changes
+}
+
+// formatPatterns renders a pattern list for the reload log
+func formatPatterns(patterns []string) string {
+	if len(patterns) == 0 {
+		return "(none)"
+	}
+	return "[" + strings.Join(patterns, ", ") + "]"
+}
+
+// updateWatches adds watches for directories that may now contain included
+// paths and removes those that no longer can
+func (m *Manager) updateWatches() ([]string, []string) {
+	wanted := make(map[string]bool)
+	m.walkConfig(m.ConfigDir, nil, func(relPath, path string, info os.FileInfo) error {
+		if !info.IsDir() {
+			return nil
+		}
+		if !m.shouldWalk(relPath) {
+			return filepath.SkipDir
+		}
+		wanted[path] = true
+		return nil
+	})
+	wanted[m.ConfigDir] = true
+
+	var added, removed []string
+	watched := make(map[string]bool)
+	for _, path := range m.FileWatcher.WatchList() {
+		watched[path] = true
+		if !wanted[path] {
+			if err := m.FileWatcher.Remove(path); err == nil {
+				removed = append(removed, m.displayPath(path))
+			}
+		}
+	}
+
+	for path := range wanted {
+		if !watched[path] {
+			if err := m.FileWatcher.Add(path); err != nil {
+				ui.PrintError(fmt.Sprintf("Error watching directory %s: %v", path, watchError(err)))
+			} else {
+				added = append(added, m.displayPath(path))
+			}
+		}
+	}
+
+	slices.Sort(added)
+	slices.Sort(removed)
+	return added, removed
+}
+
+// displayPath shows a path relative to the config directory
+func (m *Manager) displayPath(path string) string {
+	if relPath, err := filepath.Rel(m.ConfigDir, path); err == nil {
+		return relPath
+	}
+	return path
+}
+
+// findUnsyncedFiles returns included files that are missing from the
+// repository or differ from their repository copy
+func (m *Manager) findUnsyncedFiles() (map[string]bool, error) {
+	if m.InPlace {
+		return m.findUnsyncedInPlace()
+	}
+
+	unsynced := make(map[string]bool)
+
+	err := m.walkConfig(m.ConfigDir, nil, func(relPath, path string, info os.FileInfo) error {
+		if info.IsDir() {
+			if !m.shouldWalk(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !m.shouldInclude(relPath, false) {
+			return nil
+		}
+
+		targetPath := filepath.Join(m.RepoDir, m.resolveHardlink(relPath))
+		if info.Mode()&os.ModeSymlink != 0 {
+			if same, _ := sameSymlink(path, targetPath); !same {
+				unsynced[relPath] = true
+			}
+			return nil
+		}
+
+		if same, err := sameContents(path, targetPath); err != nil || !same {
+			unsynced[relPath] = true
+		}
+		return nil
+	})
+
+	return unsynced, err
+}
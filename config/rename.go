@@ -0,0 +1,186 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// renamePairWindow is how soon after a Rename event, which carries the old
+// name, the Create event of the new name must arrive for the two to be paired
+const renamePairWindow = 100 * time.Millisecond
+
+// renameLabel formats a rename for the log and commit messages
+func renameLabel(oldPath, newPath string) string {
+	return oldPath + " → " + newPath
+}
+
+// noteRenameEvent pairs a Rename event with the Create event right after it,
+// remembering the old name of the new path for detectRenames
+func (m *Manager) noteRenameEvent(event fsnotify.Event, relPath string, now time.Time) {
+	switch {
+	case event.Op&fsnotify.Rename != 0:
+		m.lastRenamed, m.lastRenamedAt = relPath, now
+	case event.Op&fsnotify.Create != 0 && m.lastRenamed != "" && m.lastRenamed != relPath && now.Sub(m.lastRenamedAt) <= renamePairWindow:
+		if m.renameHints == nil {
+			m.renameHints = make(map[string]string)
+		}
+		m.renameHints[relPath] = m.lastRenamed
+		m.lastRenamed = ""
+	}
+}
+
+// detectRenames pairs the files of a batch that disappeared from the config
+// directory with files that appeared in it, returning the old path of each
+// new one. Pairs reported by the watcher come first; the remaining files are
+// paired when their contents are identical. stored reports whether a path is
+// in the repository.
+func (m *Manager) detectRenames(changedFiles map[string]bool, stored func(relPath string) bool) map[string]string {
+	hints := maps.Clone(m.renameHints)
+	for relPath := range changedFiles {
+		delete(m.renameHints, relPath)
+	}
+
+	var gone, added []string
+	for relPath := range changedFiles {
+		info, err := m.sourceInfo(relPath)
+		switch {
+		case os.IsNotExist(err) && stored(relPath):
+			gone = append(gone, relPath)
+		case err == nil && !info.IsDir() && specialFileKind(info.Mode()) == "" && !stored(relPath) && m.resolveHardlink(relPath) == relPath:
+			added = append(added, relPath)
+		}
+	}
+
+	renames := make(map[string]string)
+	if len(gone) == 0 || len(added) == 0 {
+		return renames
+	}
+	sort.Strings(gone)
+	sort.Strings(added)
+
+	unpaired := make(map[string]bool, len(gone))
+	for _, relPath := range gone {
+		unpaired[relPath] = true
+	}
+
+	for _, relPath := range added {
+		if oldPath, ok := hints[relPath]; ok && unpaired[oldPath] {
+			renames[relPath] = oldPath
+			delete(unpaired, oldPath)
+		}
+	}
+
+	byHash := make(map[string][]string)
+	for _, relPath := range gone {
+		if !unpaired[relPath] {
+			continue
+		}
+		if hash, err := m.storedHash(relPath); err == nil {
+			byHash[hash] = append(byHash[hash], relPath)
+		}
+	}
+	if len(byHash) == 0 {
+		return renames
+	}
+
+	for _, relPath := range added {
+		if _, ok := renames[relPath]; ok {
+			continue
+		}
+		info, err := m.sourceInfo(relPath)
+		if err != nil {
+			continue
+		}
+		hash, err := hashEntry(filepath.Join(m.ConfigDir, relPath), info)
+		if err != nil || len(byHash[hash]) == 0 {
+			continue
+		}
+		renames[relPath] = byHash[hash][0]
+		byHash[hash] = byHash[hash][1:]
+	}
+
+	return renames
+}
+
+// renameInRepo moves a renamed file in the repository, copying the new
+// source so that changes made along with the rename are kept
+func (m *Manager) renameInRepo(oldPath, newPath string) error {
+	info, err := m.sourceInfo(newPath)
+	if err != nil {
+		return err
+	}
+
+	targetPath := filepath.Join(m.RepoDir, newPath)
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return err
+	}
+	if err := m.copyEntry(filepath.Join(m.ConfigDir, newPath), targetPath, info); err != nil {
+		return err
+	}
+	m.recordMetadata(newPath, info)
+
+	return m.removeFromRepo(oldPath)
+}
+
+// storedHash hashes the repository's version of a file: the copy in the
+// repository, or in in-place mode the last committed version
+func (m *Manager) storedHash(relPath string) (string, error) {
+	if !m.InPlace {
+		path := filepath.Join(m.RepoDir, relPath)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		return hashEntry(path, info)
+	}
+
+	reader, mode, err := m.GitRepo.HeadFile(relPath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if mode&os.ModeSymlink != 0 {
+		hash.Write([]byte("link:"))
+	}
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashEntry hashes a file's contents, or a link's target, as described by info
+func hashEntry(path string, info os.FileInfo) (string, error) {
+	hash := sha256.New()
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte("link:" + target))
+	case info.Mode().IsRegular():
+		file, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("%s is not a file", path)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
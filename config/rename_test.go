@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// A file renamed and edited in the same batch has different contents under
+// its new name, so only the watcher's Rename/Create pair identifies it
+func TestDetectRenamesUsesWatcherPairs(t *testing.T) {
+	configDir, repoDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(repoDir, "old.conf"), []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "new.conf"), []byte("after"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(configDir, repoDir, nil, nil, nil, time.Second, false, nil)
+	now := time.Now()
+	m.noteRenameEvent(fsnotify.Event{Name: filepath.Join(configDir, "old.conf"), Op: fsnotify.Rename}, "old.conf", now)
+	m.noteRenameEvent(fsnotify.Event{Name: filepath.Join(configDir, "new.conf"), Op: fsnotify.Create}, "new.conf", now)
+
+	stored := func(relPath string) bool {
+		_, err := os.Lstat(filepath.Join(repoDir, relPath))
+		return err == nil
+	}
+	renames := m.detectRenames(map[string]bool{"old.conf": true, "new.conf": true}, stored)
+
+	if renames["new.conf"] != "old.conf" || len(renames) != 1 {
+		t.Fatalf("renames = %v, want new.conf → old.conf", renames)
+	}
+	if len(m.renameHints) != 0 {
+		t.Errorf("hints of the batch were kept: %v", m.renameHints)
+	}
+}
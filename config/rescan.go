@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"config_handler/ui"
+)
+
+// DefaultRescanInterval is how often the config directory is compared with
+// the repository, unless the manager is given another interval
+const DefaultRescanInterval = 10 * time.Minute
+
+// rescan compares the config directory with the repository and returns the
+// paths that are out of sync, catching changes the watcher missed. Deleted
+// files already waiting in the trash are left alone.
+func (m *Manager) rescan() (map[string]bool, error) {
+	unsynced, err := m.findUnsyncedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := m.findDeletedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := make(map[string]bool)
+	if m.trashEnabled() {
+		items, err := m.TrashEntries()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			trashed[item.Path] = true
+		}
+	}
+
+	for _, relPath := range deleted {
+		if !trashed[relPath] {
+			unsynced[relPath] = true
+		}
+	}
+
+	return unsynced, nil
+}
+
+// findUnsyncedInPlace returns the included files that aren't staged or that
+// differ from their staged version
+func (m *Manager) findUnsyncedInPlace() (map[string]bool, error) {
+	unsynced, err := m.findUntrackedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	modified, err := m.GitRepo.ModifiedFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, relPath := range modified {
+		if m.shouldInclude(relPath, false) {
+			unsynced[relPath] = true
+		}
+	}
+
+	return unsynced, nil
+}
+
+// watchNewDir watches a directory created while running, along with the
+// directories inside it, and returns the included paths already in it: files
+// created before the watch was added never produce an event of their own
+func (m *Manager) watchNewDir(relPath string) map[string]bool {
+	found := make(map[string]bool)
+
+	err := m.walkConfig(filepath.Join(m.ConfigDir, relPath), nil, func(relPath, path string, info os.FileInfo) error {
+		if info.IsDir() {
+			if !m.shouldWalk(relPath) {
+				return filepath.SkipDir
+			}
+
+			if err := m.FileWatcher.Add(path); err != nil {
+				ui.PrintError(fmt.Sprintf("Failed to watch %s: %v", relPath, watchError(err)))
+			} else if m.Verbose {
+				ui.PrintInfo(fmt.Sprintf("Added new directory to watch: %s", relPath))
+			}
+		}
+
+		if m.shouldInclude(relPath, info.IsDir()) {
+			found[relPath] = true
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		ui.PrintError(fmt.Sprintf("Failed to scan %s: %v", relPath, err))
+	}
+
+	return found
+}
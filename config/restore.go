@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RestoreSummary reports the outcome of a restore
+type RestoreSummary struct {
+	Restored  []string
+	Unchanged []string
+	Conflicts []string // Files that differ locally and were left alone
+	Warnings  []string
+}
+
+// Restore copies files from the repository back into the config directory and
+// re-applies the modes recorded in the manifest. Local files that differ from
+// the repository are only replaced when overwrite is set.
+func (m *Manager) Restore(relPath string, overwrite bool) (*RestoreSummary, error) {
+	if m.InPlace {
+		return m.restoreInPlace(relPath, overwrite)
+	}
+
+	summary := &RestoreSummary{}
+	rootPath := filepath.Join(m.RepoDir, filepath.Clean(relPath))
+
+	var dirs []string
+	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Hard links are only recorded in the manifest
+			if _, ok := m.hardlinkOf(relPath); ok && path == rootPath && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(m.RepoDir, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		if isInternalFile(rel) {
+			return nil
+		}
+
+		if info.IsDir() && !m.shouldWalk(rel) {
+			return filepath.SkipDir
+		}
+		if !m.shouldInclude(rel, info.IsDir()) {
+			return nil
+		}
+
+		if info.IsDir() {
+			dirs = append(dirs, rel)
+			return nil
+		}
+
+		targetPath := filepath.Join(m.ConfigDir, rel)
+		if _, err := os.Lstat(targetPath); err == nil {
+			compare := sameContents
+			if info.Mode()&os.ModeSymlink != 0 {
+				compare = sameSymlink
+			}
+
+			same, err := compare(path, targetPath)
+			if err != nil {
+				return err
+			}
+
+			if same {
+				summary.Unchanged = append(summary.Unchanged, rel)
+				return nil
+			}
+
+			if !overwrite {
+				summary.Conflicts = append(summary.Conflicts, rel)
+				return nil
+			}
+		}
+
+		warnings, err := m.restoreFile(rel)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", rel, err)
+		}
+		summary.Restored = append(summary.Restored, rel)
+		summary.Warnings = append(summary.Warnings, warnings...)
+
+		return nil
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	if err := m.restoreHardlinks(relPath, overwrite, summary); err != nil {
+		return summary, err
+	}
+
+	// Apply directory modes last and deepest first, so restrictive modes
+	// don't prevent restoring the files inside
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		targetPath := filepath.Join(m.ConfigDir, dir)
+		if err := os.MkdirAll(targetPath, 0755); err != nil {
+			return summary, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+
+		warnings, err := m.applyMetadata(dir, targetPath)
+		if err != nil {
+			return summary, fmt.Errorf("failed to restore permissions of %s: %w", dir, err)
+		}
+		summary.Warnings = append(summary.Warnings, warnings...)
+	}
+
+	return summary, nil
+}
+
+// restoreFile copies a single file from the repository into the config
+// directory and re-applies its recorded metadata
+func (m *Manager) restoreFile(relPath string) ([]string, error) {
+	sourcePath := filepath.Join(m.RepoDir, relPath)
+	targetPath := filepath.Join(m.ConfigDir, relPath)
+
+	err := os.MkdirAll(filepath.Dir(targetPath), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", filepath.Dir(targetPath), err)
+	}
+
+	info, err := os.Lstat(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Links stored with the link policy are recreated as links
+	err = m.copyEntry(sourcePath, targetPath, info)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, nil
+	}
+	return m.applyMetadata(relPath, targetPath)
+}
+
+// sameContents reports whether two files have identical contents
+func sameContents(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+
+	if infoA.Size() != infoB.Size() || infoA.IsDir() != infoB.IsDir() {
+		return false, nil
+	}
+
+	fileA, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fileA.Close()
+
+	fileB, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fileB.Close()
+
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+	for {
+		nA, errA := io.ReadFull(fileA, bufA)
+		nB, errB := io.ReadFull(fileB, bufB)
+
+		if !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		} else if errA != nil {
+			return false, errA
+		} else if errB != nil {
+			return false, errB
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Root is a source directory synced into its own directory of the repository
+type Root struct {
+	Source string // Directory the files are synced from
+	Prefix string // Directory of the repository they are stored in ("" for the top level)
+}
+
+// reservedPath is a path below ConfigDir that the manager leaves alone
+// because it belongs to another root or holds the repository
+type reservedPath struct {
+	relPath string
+	reason  string
+}
+
+// SetRoot stores the manager's files in the prefix directory of the
+// repository at repoRoot. Sources and prefixes of the other roots, and the
+// repository itself, are never synced by this manager.
+func (m *Manager) SetRoot(repoRoot, prefix string, others []Root) {
+	m.RepoPrefix = filepath.Clean(prefix)
+	if m.RepoPrefix == "." {
+		m.RepoPrefix = ""
+	}
+	m.RepoDir = filepath.Join(repoRoot, m.RepoPrefix)
+	m.repoRoot, m.otherRoots = repoRoot, others
+
+	m.reserved = nil
+	if relPath, ok := relativeTo(m.ConfigDir, repoRoot); ok {
+		m.reserved = append(m.reserved, reservedPath{relPath, "holds the repository"})
+	}
+
+	for _, other := range others {
+		if relPath, ok := relativeTo(m.ConfigDir, other.Source); ok {
+			m.reserved = append(m.reserved, reservedPath{relPath, "is synced as the root " + other.Source})
+		}
+
+		// Files here would end up in the other root's repository directory
+		otherPrefix := filepath.Clean(other.Prefix)
+		if relPath, ok := relativeTo(m.RepoDir, filepath.Join(repoRoot, otherPrefix)); ok {
+			m.reserved = append(m.reserved, reservedPath{relPath, "is the repository directory of the root " + other.Source})
+		}
+	}
+}
+
+// reservedReason returns why a path belongs to another root, or "" if it doesn't
+func (m *Manager) reservedReason(relPath string) string {
+	for _, reserved := range m.reserved {
+		if relPath == reserved.relPath || strings.HasPrefix(relPath, reserved.relPath+string(filepath.Separator)) {
+			return reserved.relPath + " " + reserved.reason
+		}
+	}
+	return ""
+}
+
+// repoPath converts a path relative to ConfigDir into a path relative to the
+// top level of the repository, as used by git and the trash
+func (m *Manager) repoPath(relPath string) string {
+	return filepath.Join(m.RepoPrefix, relPath)
+}
+
+// repoPaths converts several paths with repoPath
+func (m *Manager) repoPaths(relPaths []string) []string {
+	paths := make([]string, 0, len(relPaths))
+	for _, relPath := range relPaths {
+		paths = append(paths, m.repoPath(relPath))
+	}
+	return paths
+}
+
+// fromRepoPath converts a path relative to the top level of the repository
+// into a path relative to ConfigDir. It fails for paths of other roots.
+func (m *Manager) fromRepoPath(path string) (string, bool) {
+	relPath := path
+	if m.RepoPrefix != "" {
+		var ok bool
+		if relPath, ok = relativeTo(m.RepoPrefix, path); !ok {
+			return "", false
+		}
+	}
+
+	if m.reservedReason(relPath) != "" {
+		return "", false
+	}
+	return relPath, true
+}
+
+// trackedFiles returns the files of this root recorded in the repository
+// index, relative to ConfigDir
+func (m *Manager) trackedFiles() ([]string, error) {
+	tracked, err := m.GitRepo.TrackedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(tracked))
+	for _, path := range tracked {
+		if relPath, ok := m.fromRepoPath(path); ok {
+			files = append(files, relPath)
+		}
+	}
+	return files, nil
+}
+
+// relativeTo returns path relative to dir if it is strictly inside dir
+func relativeTo(dir, path string) (string, bool) {
+	if filepath.IsAbs(dir) != filepath.IsAbs(path) {
+		dir, _ = filepath.Abs(dir)
+		path, _ = filepath.Abs(path)
+	}
+
+	relPath, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return relPath, true
+}
+
+// syncWithRemote commits and pushes the changes of this root's directory of
+// the repository
+func (m *Manager) syncWithRemote(message string) error {
+	return m.GitRepo.SyncDirWithRemote(m.RepoPrefix, message)
+}
+
+// LockWorkTree keeps the other roots, and other processes sharing the
+// repository, from changing it until the returned function is called
+func (m *Manager) LockWorkTree() func() {
+	if m.GitRepo == nil {
+		return func() {}
+	}
+	m.GitRepo.LockWorkTree()
+	return m.GitRepo.UnlockWorkTree
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// RuleDecision describes how the include/exclude patterns and ignore files treat a path
+type RuleDecision struct {
+	// Included is set for paths that are synced
+	Included bool
+	// Descend is set for directories that aren't included themselves but are
+	// walked and watched because they may contain included paths
+	Descend bool
+	// Reason names the rule that decided
+	Reason string
+
+	explicit bool // Excluded by an exclude pattern or ignore file
+}
+
+// Explain returns the decision for a path in the config directory, as used by
+// the initial sync, the watcher and restore. A path inside a directory that
+// isn't walked is never reached, whatever its own rules say.
+func (m *Manager) Explain(relPath string) RuleDecision {
+	relPath = filepath.Clean(relPath)
+
+	parts := splitPath(relPath)
+	for i := 1; i < len(parts); i++ {
+		dir := filepath.Join(parts[:i]...)
+		if decision := m.decide(dir, true); !decision.Included && !decision.Descend {
+			return RuleDecision{Reason: fmt.Sprintf("inside %s, which is excluded: %s", dir, decision.Reason)}
+		}
+	}
+
+	return m.decide(relPath, m.isDirPath(relPath))
+}
+
+// decide evaluates the rules for a path in order: git metadata, paths of other
+// roots, ignore files, exclude patterns, then include patterns
+func (m *Manager) decide(relPath string, isDir bool) RuleDecision {
+	return m.decideWith(m.ignoreRules, relPath, isDir)
+}
+
+// decideWith is decide with the given ignore rules in place of the loaded ones
+func (m *Manager) decideWith(rules []ignoreRule, relPath string, isDir bool) RuleDecision {
+	if isGitPath(relPath) {
+		return RuleDecision{Reason: "git metadata is never synced"}
+	}
+
+	if reason := m.reservedReason(relPath); reason != "" {
+		return RuleDecision{Reason: reason, explicit: true}
+	}
+
+	rule, result := matchIgnoreRules(rules, relPath, isDir)
+	if result == gitignore.Exclude {
+		return RuleDecision{Reason: fmt.Sprintf("ignored by %q at %s", rule.text, rule.source), explicit: true}
+	}
+
+	for i, pattern := range m.ExcludeGlobs {
+		if pattern.Match(relPath) {
+			return RuleDecision{Reason: fmt.Sprintf("matches exclude pattern %q", m.patternText(m.excludePatterns, i)), explicit: true}
+		}
+	}
+
+	if len(m.IncludeGlobs) == 0 {
+		if result == gitignore.Include {
+			return RuleDecision{Included: true, Reason: fmt.Sprintf("re-included by %q at %s", rule.text, rule.source)}
+		}
+		return RuleDecision{Included: true, Reason: "no include patterns are set and no exclude rule matches"}
+	}
+
+	for i, pattern := range m.IncludeGlobs {
+		if pattern.Match(relPath) {
+			return RuleDecision{Included: true, Reason: fmt.Sprintf("matches include pattern %q", m.patternText(m.includePatterns, i))}
+		}
+	}
+
+	// Everything inside an included directory is included
+	for dir := filepath.Dir(relPath); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		for i, pattern := range m.IncludeGlobs {
+			if pattern.Match(dir) {
+				return RuleDecision{Included: true, Reason: fmt.Sprintf("inside %s, which matches include pattern %q", dir, m.patternText(m.includePatterns, i))}
+			}
+		}
+	}
+
+	if isDir {
+		for _, pattern := range m.includePatterns {
+			if couldContainMatch(pattern, relPath) {
+				return RuleDecision{Descend: true, Reason: fmt.Sprintf("may contain paths matching include pattern %q", pattern)}
+			}
+		}
+	}
+
+	return RuleDecision{Reason: "matches no include pattern"}
+}
+
+// patternText returns the source of the i-th compiled pattern
+func (m *Manager) patternText(patterns []string, i int) string {
+	if i < len(patterns) {
+		return patterns[i]
+	}
+	return "?"
+}
+
+// couldContainMatch reports whether paths below dir may match a glob pattern.
+// It compares the literal prefix of the pattern with the directory, so it can
+// answer yes for a directory without matches but never misses one.
+func couldContainMatch(pattern, dir string) bool {
+	prefix := filepath.ToSlash(dir) + "/"
+
+	literal := pattern
+	if i := strings.IndexAny(pattern, "*?[{\\"); i >= 0 {
+		literal = pattern[:i]
+	} else {
+		// A pattern without wildcards only matches itself
+		return strings.HasPrefix(pattern, prefix)
+	}
+
+	return strings.HasPrefix(literal, prefix) || strings.HasPrefix(prefix, literal)
+}
+
+// UnmatchedIncludes returns the include patterns that don't match any synced
+// path in the config directory, either because nothing matches them or because
+// everything they match is excluded by other rules
+func (m *Manager) UnmatchedIncludes() ([]string, error) {
+	matched := make([]bool, len(m.IncludeGlobs))
+
+	err := m.walkConfig(m.ConfigDir, nil, func(relPath, path string, info os.FileInfo) error {
+		decision := m.decide(relPath, info.IsDir())
+		if info.IsDir() && !decision.Included && !decision.Descend {
+			return filepath.SkipDir
+		}
+		if !decision.Included {
+			return nil
+		}
+
+		for i, pattern := range m.IncludeGlobs {
+			if !matched[i] && pattern.Match(relPath) {
+				matched[i] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var unmatched []string
+	for i, ok := range matched {
+		if !ok {
+			unmatched = append(unmatched, m.patternText(m.includePatterns, i))
+		}
+	}
+	return unmatched, nil
+}
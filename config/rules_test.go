@@ -0,0 +1,69 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCouldContainMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		dir     string
+		want    bool
+	}{
+		{"nvim/init.vim", "nvim", true},
+		{"nvim/init.vim", "i3", false},
+		{"nvim/init.vim", "nvim/lua", false},
+		{"nvim", "nvim", false},
+		{"a/b/c.conf", "a", true},
+		{"a/b/c.conf", "a/b", true},
+		{"a/*/c.conf", "a/x", true},
+		{"a/*/c.conf", "b", false},
+		{"a/b*", "a", true},
+		{"a/b*", "a/bx", true},
+		{"a/b*", "a/c", false},
+		{"*.conf", "anything", true},
+		{"**/init.vim", "deep/down", true},
+	}
+
+	for _, tt := range tests {
+		if got := couldContainMatch(tt.pattern, filepath.FromSlash(tt.dir)); got != tt.want {
+			t.Errorf("couldContainMatch(%q, %q) = %v, want %v", tt.pattern, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestDecideNestedIncludes(t *testing.T) {
+	m := NewManager(t.TempDir(), t.TempDir(), nil, []string{"nvim/init.vim", "i3", "a/*/c.conf"}, []string{"i3/*.bak"}, time.Second, false, nil)
+
+	tests := []struct {
+		relPath  string
+		isDir    bool
+		included bool
+		descend  bool
+	}{
+		{"nvim", true, false, true},
+		{"nvim", false, false, false},
+		{"nvim/init.vim", false, true, false},
+		{"nvim/lua", true, false, false},
+		{"nvim/lua/plugins.lua", false, false, false},
+		{"i3", true, true, false},
+		{"i3/config", false, true, false},
+		{"i3/config.bak", false, false, false},
+		{"a", true, false, true},
+		{"a/x", true, false, true},
+		{"a/x/c.conf", false, true, false},
+		{"a/x/d.conf", false, false, false},
+		{"polybar", true, false, false},
+		{".git", true, false, false},
+	}
+
+	for _, tt := range tests {
+		decision := m.decide(filepath.FromSlash(tt.relPath), tt.isDir)
+		if decision.Included != tt.included || decision.Descend != tt.descend {
+			t.Errorf("decide(%s, dir=%v) = included %v, descend %v (%s), want %v, %v",
+				tt.relPath, tt.isDir, decision.Included, decision.Descend, decision.Reason, tt.included, tt.descend)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stop stops the watcher and syncs the changes still waiting in it, giving
+// up once ctx is done. It returns an error if they weren't committed and
+// pushed. A sync already running when Stop is called finishes first.
+func (m *Manager) Stop(ctx context.Context) error {
+	if m.stopRequests == nil {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	select {
+	case m.stopRequests <- done:
+	case <-m.loopDone:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the watcher didn't stop in time: %w", ctx.Err())
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("pending changes weren't synced in time: %w", ctx.Err())
+	}
+}
+
+// shutdown closes the watchers and syncs the pending paths; it runs on the
+// watcher loop
+func (m *Manager) shutdown(pending map[string]bool) error {
+	m.FileWatcher.Close()
+	if m.configWatcher != nil {
+		m.configWatcher.Close()
+	}
+	if m.State != nil {
+		m.State.ClearWatcherStatus(m.ConfigDir)
+		// A pause ends with the process; the next start checks the changes again
+		defer m.State.ClearSyncPause(m.ConfigDir)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	m.syncErr = nil
+	if !m.syncChangedFiles(pending) {
+		return fmt.Errorf("syncing is paused, so %d changed paths were not committed", len(pending))
+	}
+	return m.syncErr
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"time"
+)
+
+// stabilityInterval is how long a changed file's size and modification time
+// must stay the same before it is copied
+const stabilityInterval = 100 * time.Millisecond
+
+// fileState is what the stability check compares. A path that disappears or
+// comes back also counts as a change, so the gap of an atomic save, where the
+// old file is renamed away just before the new one takes its place, is never
+// mistaken for a deletion.
+type fileState struct {
+	exists  bool
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// fileState describes a path in the config directory the way it is synced
+func (m *Manager) fileState(relPath string) fileState {
+	info, err := m.sourceInfo(relPath)
+	if err != nil {
+		return fileState{}
+	}
+
+	// Directories change whenever an entry does, which their files report
+	if info.IsDir() {
+		return fileState{exists: true, isDir: true}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// unstableFiles returns the paths that are still being written: those whose
+// size or modification time changed, or that appeared or disappeared, within
+// the stability interval
+func (m *Manager) unstableFiles(files map[string]bool) map[string]bool {
+	unstable := make(map[string]bool)
+	if len(files) == 0 {
+		return unstable
+	}
+
+	before := make(map[string]fileState, len(files))
+	for relPath := range files {
+		before[relPath] = m.fileState(relPath)
+	}
+
+	time.Sleep(stabilityInterval)
+
+	for relPath, state := range before {
+		if m.fileState(relPath) != state {
+			unstable[relPath] = true
+		}
+	}
+	return unstable
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"config_handler/ui"
+)
+
+// Default storm detection settings, used unless the manager is given others
+const (
+	DefaultStormThreshold = 200
+	DefaultStormWindow    = 10 * time.Second
+)
+
+// maxStormDuration bounds how long a storm is held back, so a directory that
+// is rewritten all the time is still synced
+const maxStormDuration = 5 * time.Minute
+
+// stormDetector counts change events over a sliding window. When more than
+// threshold events arrive within the window a storm begins: settled paths are
+// collected instead of committed batch by batch, and the storm is committed
+// as a whole once the rate has dropped below half the threshold.
+type stormDetector struct {
+	threshold int
+	window    time.Duration
+	events    []time.Time
+
+	started time.Time
+	count   int
+	files   map[string]bool
+}
+
+// newStormDetector creates a detector; a threshold of 0 disables it
+func newStormDetector(threshold int, window time.Duration) *stormDetector {
+	return &stormDetector{threshold: threshold, window: window}
+}
+
+// setLimits changes the threshold and window, for config reloads
+func (s *stormDetector) setLimits(threshold int, window time.Duration) {
+	s.threshold, s.window = threshold, window
+}
+
+// record counts an event and reports whether it started a storm
+func (s *stormDetector) record(now time.Time) bool {
+	if s.threshold <= 0 {
+		return false
+	}
+
+	s.events = append(s.events, now)
+	s.trim(now)
+
+	if s.active() {
+		s.count++
+		return false
+	}
+	if len(s.events) <= s.threshold {
+		return false
+	}
+
+	s.started = now
+	s.count = len(s.events)
+	s.files = make(map[string]bool)
+	return true
+}
+
+// active reports whether a storm is in progress
+func (s *stormDetector) active() bool {
+	return !s.started.IsZero()
+}
+
+// hold collects settled paths until the storm is over
+func (s *stormDetector) hold(files map[string]bool) {
+	for relPath := range files {
+		s.files[relPath] = true
+	}
+}
+
+// over reports whether the storm has calmed down, given whether any changes
+// are still waiting to settle, or has gone on for too long
+func (s *stormDetector) over(now time.Time, settled bool) bool {
+	if !s.active() {
+		return false
+	}
+	if now.Sub(s.started) >= maxStormDuration {
+		return true
+	}
+
+	s.trim(now)
+	return settled && (s.threshold <= 0 || len(s.events)*2 < s.threshold)
+}
+
+// take ends the storm, returning the collected paths and the event count
+func (s *stormDetector) take() (map[string]bool, int) {
+	files, count := s.files, s.count
+	s.started, s.count, s.files = time.Time{}, 0, nil
+	return files, count
+}
+
+// trim forgets events that have left the window
+func (s *stormDetector) trim(now time.Time) {
+	i := 0
+	for i < len(s.events) && now.Sub(s.events[i]) > s.window {
+		i++
+	}
+	s.events = s.events[i:]
+}
+
+// describeStorm reports a finished storm and returns the note for its commit
+// message, suggesting to exclude the directory most of it happened in
+func (m *Manager) describeStorm(files map[string]bool, count int) string {
+	dir := noisyDir(files)
+	if dir == "" {
+		ui.PrintWarning(fmt.Sprintf("Burst of %d changes to %d files is over; committing it at once", count, len(files)))
+		return fmt.Sprintf("Burst of %d changed files", len(files))
+	}
+
+	ui.PrintWarning(fmt.Sprintf("Burst of %d changes to %d files under %s is over; committing it at once", count, len(files), dir))
+	ui.PrintInfo(fmt.Sprintf("If %s doesn't need syncing, add %q to the exclude patterns", filepath.Join(m.ConfigDir, dir), filepath.ToSlash(dir)))
+	return fmt.Sprintf("Burst of %d changed files under %s", len(files), filepath.ToSlash(dir))
+}
+
+// noisyDir returns the deepest directory holding at least four fifths of
+// the files, or "" if they are spread over the whole config directory
+func noisyDir(files map[string]bool) string {
+	counts := make(map[string]int)
+	for relPath := range files {
+		for dir := filepath.Dir(relPath); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			counts[dir]++
+		}
+	}
+
+	best := ""
+	for dir, count := range counts {
+		if count*5 < len(files)*4 {
+			continue
+		}
+		if depth := strings.Count(dir, string(filepath.Separator)); best == "" || depth > strings.Count(best, string(filepath.Separator)) {
+			best = dir
+		}
+	}
+	return best
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStormDetectorWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		events    int           // Recorded back to back
+		spacing   time.Duration // Between events
+		want      bool          // Whether a storm started
+	}{
+		{"at the threshold", 10, 10, 0, false},
+		{"above the threshold", 10, 11, 0, true},
+		{"spread beyond the window", 10, 30, 500 * time.Millisecond, false},
+		{"just inside the window", 10, 11, 400 * time.Millisecond, true},
+		{"disabled", 0, 1000, 0, false},
+	}
+
+	start := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStormDetector(tt.threshold, 4*time.Second)
+
+			started := false
+			for i := 0; i < tt.events; i++ {
+				if s.record(start.Add(time.Duration(i) * tt.spacing)) {
+					started = true
+				}
+			}
+			if started != tt.want || s.active() != tt.want {
+				t.Errorf("storm started = %v, active = %v, want %v", started, s.active(), tt.want)
+			}
+		})
+	}
+}
+
+func TestStormDetectorOver(t *testing.T) {
+	window := 4 * time.Second
+	start := time.Now()
+
+	tests := []struct {
+		name    string
+		after   time.Duration // Since the last event
+		settled bool
+		want    bool
+	}{
+		{"events still in the window", time.Second, true, false},
+		{"changes still settling", 2 * window, false, false},
+		{"window empty and settled", 2 * window, true, true},
+		{"held back for too long", maxStormDuration, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStormDetector(10, window)
+			for i := 0; i < 11; i++ {
+				s.record(start)
+			}
+			if !s.active() {
+				t.Fatal("storm did not start")
+			}
+
+			if got := s.over(start.Add(tt.after), tt.settled); got != tt.want {
+				t.Errorf("over() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoisyDir(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"one directory", []string{"app/cache/a", "app/cache/b", "app/cache/c", "app/cache/d"}, "app/cache"},
+		{"four fifths in one directory", []string{"app/cache/a", "app/cache/b", "app/cache/c", "app/cache/d", "app/x"}, "app/cache"},
+		{"less than four fifths", []string{"app/cache/a", "app/cache/b", "app/cache/c", "app/x", "app/y"}, "app"},
+		{"spread out", []string{"a/1", "b/1", "c/1", "d/1"}, ""},
+		{"top level files", []string{"a", "b"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]bool)
+			for _, file := range tt.files {
+				files[filepath.FromSlash(file)] = true
+			}
+			if got := noisyDir(files); got != filepath.FromSlash(tt.want) {
+				t.Errorf("noisyDir = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
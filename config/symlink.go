@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gobwas/glob"
+)
+
+// SymlinkPolicy defines how a symbolic link in the config directory is synced
+type SymlinkPolicy string
+
+const (
+	// SymlinkLink stores the link itself in the repository
+	SymlinkLink SymlinkPolicy = "link"
+	// SymlinkFollow copies the file or directory the link points to
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkSkip ignores the link
+	SymlinkSkip SymlinkPolicy = "skip"
+)
+
+// SymlinkRule applies a symlink policy to links whose path matches a glob pattern
+type SymlinkRule struct {
+	Pattern string
+	Policy  SymlinkPolicy
+}
+
+// symlinkMatcher is a compiled SymlinkRule
+type symlinkMatcher struct {
+	glob   glob.Glob
+	policy SymlinkPolicy
+}
+
+// errSymlinkSkipped is returned for links whose policy is SymlinkSkip
+var errSymlinkSkipped = errors.New("symlink skipped by policy")
+
+// ParseSymlinkPolicy validates a policy name
+func ParseSymlinkPolicy(value string) (SymlinkPolicy, error) {
+	switch policy := SymlinkPolicy(value); policy {
+	case SymlinkLink, SymlinkFollow, SymlinkSkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown symlink policy %q (use link, follow or skip)", value)
+	}
+}
+
+// SetSymlinkRules sets the default symlink policy and the per-glob rules,
+// which are checked in order with the first match winning
+func (m *Manager) SetSymlinkRules(defaultPolicy SymlinkPolicy, rules []SymlinkRule) error {
+	matchers := make([]symlinkMatcher, 0, len(rules))
+	for _, rule := range rules {
+		policy, err := ParseSymlinkPolicy(string(rule.Policy))
+		if err != nil {
+			return err
+		}
+
+		g, err := glob.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid symlink pattern %q: %w", rule.Pattern, err)
+		}
+
+		matchers = append(matchers, symlinkMatcher{glob: g, policy: policy})
+	}
+
+	m.SymlinkPolicy = defaultPolicy
+	m.symlinkRules = matchers
+	m.symlinkSources = rules
+	return nil
+}
+
+// symlinkPolicy returns the policy for the link at relPath. In-place mode
+// can't copy a link's target into the work tree, so it stores links as links.
+func (m *Manager) symlinkPolicy(relPath string) SymlinkPolicy {
+	policy := m.SymlinkPolicy
+	for _, rule := range m.symlinkRules {
+		if rule.glob.Match(relPath) {
+			policy = rule.policy
+			break
+		}
+	}
+
+	if policy == "" {
+		policy = SymlinkFollow
+	}
+	if policy == SymlinkFollow && m.InPlace {
+		return SymlinkLink
+	}
+	return policy
+}
+
+// sourceInfo describes a path in the config directory the way it is synced:
+// the link itself for the link policy, or its target for the follow policy
+func (m *Manager) sourceInfo(relPath string) (os.FileInfo, error) {
+	sourcePath := filepath.Join(m.ConfigDir, relPath)
+
+	info, err := os.Lstat(sourcePath)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return info, err
+	}
+
+	switch m.symlinkPolicy(relPath) {
+	case SymlinkLink:
+		return info, nil
+	case SymlinkSkip:
+		return nil, errSymlinkSkipped
+	default:
+		return os.Stat(sourcePath)
+	}
+}
+
+// copyEntry copies a file or, for the link policy, a symbolic link
+func (m *Manager) copyEntry(src, dst string, info os.FileInfo) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return copySymlink(src, dst)
+	}
+	return copyFile(src, dst, m.PreserveXattrs)
+}
+
+// ensureDir creates a directory, replacing a symbolic link left at its place
+// so that nothing is ever written through a link into its target
+func ensureDir(path string, mode os.FileMode) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(path, mode)
+}
+
+// copySymlink recreates the symbolic link src at dst
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	// A directory at dst was synced with the follow policy before
+	if info, err := os.Lstat(dst); err == nil && info.IsDir() {
+		if err := removeDirectory(dst); err != nil {
+			return err
+		}
+	}
+
+	// Create the link under a temporary name and rename it so the swap is atomic
+	tempPath := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-link")
+	os.Remove(tempPath)
+
+	if err := os.Symlink(target, tempPath); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, dst); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return nil
+}
+
+// sameSymlink reports whether two paths are symbolic links to the same target
+func sameSymlink(a, b string) (bool, error) {
+	targetA, err := os.Readlink(a)
+	if err != nil {
+		return false, err
+	}
+
+	targetB, err := os.Readlink(b)
+	if err != nil {
+		return false, nil
+	}
+
+	return targetA == targetB, nil
+}
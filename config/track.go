@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// TrackPath copies the included files at or below relPath into the repository,
+// returning the files that were added or updated
+func (m *Manager) TrackPath(relPath string) ([]string, error) {
+	if m.InPlace {
+		return m.trackInPlace(relPath)
+	}
+
+	rootPath := filepath.Join(m.ConfigDir, relPath)
+	if _, err := os.Lstat(rootPath); err != nil {
+		return nil, err
+	}
+
+	var synced []string
+	hardlinks := make(hardlinkTracker)
+	err := m.walkConfig(rootPath, nil, func(relPath, path string, info os.FileInfo) error {
+		if info.IsDir() {
+			if !m.shouldWalk(relPath) {
+				return filepath.SkipDir
+			}
+			if m.shouldInclude(relPath, true) {
+				m.recordMetadata(relPath, info)
+				return ensureDir(filepath.Join(m.RepoDir, relPath), info.Mode())
+			}
+			return nil
+		}
+
+		if !m.shouldInclude(relPath, false) {
+			return nil
+		}
+
+		if primary, ok := hardlinks.primary(relPath, info); ok {
+			m.recordHardlink(relPath, primary)
+			return nil
+		}
+
+		targetPath := filepath.Join(m.RepoDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(targetPath), err)
+		}
+
+		if err := m.copyEntry(path, targetPath, info); err != nil {
+			return fmt.Errorf("failed to copy file %s: %w", relPath, err)
+		}
+		m.recordMetadata(relPath, info)
+
+		synced = append(synced, relPath)
+		return nil
+	})
+	if err != nil {
+		return synced, err
+	}
+
+	return synced, m.saveManifest()
+}
+
+// UntrackPath removes the files at or below relPath from the repository,
+// leaving the config directory untouched, and returns the removed files
+func (m *Manager) UntrackPath(relPath string) ([]string, error) {
+	if m.InPlace {
+		return m.untrackInPlace(relPath)
+	}
+
+	rootPath := filepath.Join(m.RepoDir, relPath)
+
+	var files []string
+	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			rel, err := filepath.Rel(m.RepoDir, path)
+			if err != nil {
+				return err
+			}
+			if !isInternalFile(rel) {
+				files = append(files, rel)
+			}
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	removed := make([]string, 0, len(files))
+	for _, file := range files {
+		if err := m.removeFromRepo(file); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", file, err)
+		}
+		removed = append(removed, file)
+	}
+
+	// Hard links to the removed files are only recorded in the manifest
+	m.forgetMetadata(relPath)
+	m.pruneManifest()
+
+	// Nothing is left for the trash to delete
+	if m.State != nil && len(removed) > 0 {
+		if err := m.State.RemoveFromTrash(m.repoPaths(removed)); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, m.saveManifest()
+}
+
+// TrackedFiles returns the synced files in the repository, sorted
+func (m *Manager) TrackedFiles() ([]string, error) {
+	tracked, err := m.trackedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(tracked))
+	for _, relPath := range tracked {
+		if !isInternalFile(relPath) {
+			files = append(files, relPath)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"config_handler/ui"
+)
+
+// trashEnabled reports whether deletions wait in the trash before leaving the repository
+func (m *Manager) trashEnabled() bool {
+	return m.State != nil && m.TrashGracePeriod > 0 && !m.InPlace
+}
+
+// moveToTrash queues a deleted file, or every file below a deleted directory,
+// in the trash. The repository copy is kept until the grace period expires.
+func (m *Manager) moveToTrash(relPath string) ([]string, error) {
+	targetPath := filepath.Join(m.RepoDir, relPath)
+
+	var trashed []string
+	err := filepath.Walk(targetPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			rel, err := filepath.Rel(m.RepoDir, path)
+			if err != nil {
+				return err
+			}
+			trashed = append(trashed, rel)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := m.State.AddToTrash(m.repoPaths(trashed), time.Now()); err != nil {
+		return nil, err
+	}
+
+	return trashed, nil
+}
+
+// collectExpiredTrash returns trashed files whose grace period has elapsed and
+// that are still missing from the config directory. Files that came back are
+// dropped from the trash.
+func (m *Manager) collectExpiredTrash() ([]string, error) {
+	expired, err := m.State.ExpiredTrash(m.TrashGracePeriod, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var restored, deleted []string
+	for _, entry := range expired {
+		relPath, ok := m.fromRepoPath(entry.Path)
+		if !ok {
+			continue
+		}
+
+		if _, err := os.Lstat(filepath.Join(m.ConfigDir, relPath)); err == nil {
+			restored = append(restored, relPath)
+		} else {
+			deleted = append(deleted, relPath)
+		}
+	}
+
+	if len(restored) > 0 {
+		if err := m.State.RemoveFromTrash(m.repoPaths(restored)); err != nil {
+			return nil, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// purgeExpiredTrash removes files from the repository once their grace period
+// has elapsed and commits the deletions
+func (m *Manager) purgeExpiredTrash() {
+	if !m.trashEnabled() {
+		return
+	}
+
+	expired, err := m.collectExpiredTrash()
+	if err != nil {
+		ui.PrintError("Failed to read trash: " + err.Error())
+		return
+	}
+
+	if len(expired) == 0 {
+		return
+	}
+
+	batch := make(map[string]bool, len(expired))
+	for _, relPath := range expired {
+		batch[relPath] = true
+	}
+
+	if !m.syncAllowed(batch) {
+		return
+	}
+	defer m.LockWorkTree()()
+
+	ui.PrintSection("Emptying Trash")
+	deletedFiles := m.removeDeletedFiles(expired)
+	if err := m.State.RemoveFromTrash(m.repoPaths(deletedFiles)); err != nil {
+		ui.PrintError("Failed to update trash: " + err.Error())
+	}
+
+	if len(deletedFiles) == 0 {
+		return
+	}
+
+	if err := m.saveManifest(); err != nil {
+		ui.PrintError("Failed to update manifest: " + err.Error())
+	}
+
+	commitMsg := buildCommitMessage(map[string]string{"deleted": strings.Join(deletedFiles, ", ")}, len(deletedFiles))
+	err = m.syncWithRemote(commitMsg)
+	if err != nil {
+		ui.PrintError("Failed to sync with remote: " + err.Error())
+		if m.NotifyManager != nil {
+			m.NotifyManager.SyncError("Failed to sync with remote: " + err.Error())
+		}
+	} else {
+		ui.PrintSuccess(fmt.Sprintf("Removed %d files whose grace period expired", len(deletedFiles)))
+		if m.NotifyManager != nil {
+			m.NotifyManager.SyncSuccess(fmt.Sprintf("Removed %d deleted files from the repository", len(deletedFiles)))
+		}
+	}
+	ui.PrintSeparator()
+}
+
+// TrashItem describes a trashed file and when it will be removed from the repository
+type TrashItem struct {
+	Path      string
+	DeletedAt time.Time
+	ExpiresAt time.Time
+}
+
+// TrashEntries returns the files of this root currently waiting in the trash
+func (m *Manager) TrashEntries() ([]TrashItem, error) {
+	if m.State == nil {
+		return nil, fmt.Errorf("no state store configured")
+	}
+
+	entries, err := m.State.TrashEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]TrashItem, 0, len(entries))
+	for _, entry := range entries {
+		relPath, ok := m.fromRepoPath(entry.Path)
+		if !ok {
+			continue
+		}
+
+		items = append(items, TrashItem{
+			Path:      relPath,
+			DeletedAt: entry.DeletedAt,
+			ExpiresAt: entry.DeletedAt.Add(m.TrashGracePeriod),
+		})
+	}
+
+	return items, nil
+}
+
+// RestoreFromTrash copies a trashed file, or every trashed file below a
+// directory, from the repository back into the config directory
+func (m *Manager) RestoreFromTrash(relPath string) ([]string, error) {
+	if m.State == nil {
+		return nil, fmt.Errorf("no state store configured")
+	}
+
+	entries, err := m.TrashEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	relPath = filepath.Clean(relPath)
+	prefix := relPath + string(filepath.Separator)
+
+	var restored, present []string
+	for _, entry := range entries {
+		if entry.Path != relPath && relPath != "." && !strings.HasPrefix(entry.Path, prefix) {
+			continue
+		}
+
+		targetPath := filepath.Join(m.ConfigDir, entry.Path)
+
+		// Never overwrite a file that has been recreated in the meantime
+		if _, err := os.Lstat(targetPath); err == nil {
+			ui.PrintWarning("Skipping " + entry.Path + ": file already exists in the configuration directory")
+			present = append(present, entry.Path)
+			continue
+		}
+
+		warnings, err := m.restoreFile(entry.Path)
+		if err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", entry.Path, err)
+		}
+		for _, warning := range warnings {
+			ui.PrintWarning(warning)
+		}
+
+		restored = append(restored, entry.Path)
+	}
+
+	if len(restored) == 0 && len(present) == 0 {
+		return nil, fmt.Errorf("%s is not in the trash", relPath)
+	}
+
+	if err := m.State.RemoveFromTrash(m.repoPaths(append(restored, present...))); err != nil {
+		return restored, err
+	}
+
+	return restored, nil
+}
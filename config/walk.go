@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"config_handler/ui"
+)
+
+// walkFunc is called for every entry found by walkConfig. info describes the
+// entry the way it is synced (see sourceInfo). Returning filepath.SkipDir for
+// a directory skips its contents.
+type walkFunc func(relPath, path string, info os.FileInfo) error
+
+// skipReport collects the included paths a walk left out, grouped by reason
+type skipReport struct {
+	skipped map[string][]string
+}
+
+// add records a skipped path. It is a no-op on a nil report.
+func (r *skipReport) add(reason, relPath string) {
+	if r == nil {
+		return
+	}
+	if r.skipped == nil {
+		r.skipped = make(map[string][]string)
+	}
+	r.skipped[reason] = append(r.skipped[reason], relPath)
+}
+
+// count returns the number of skipped paths
+func (r *skipReport) count() int {
+	total := 0
+	for _, paths := range r.skipped {
+		total += len(paths)
+	}
+	return total
+}
+
+// print shows how many paths were skipped for each reason
+func (r *skipReport) print(verbose bool) {
+	if r.count() == 0 {
+		return
+	}
+
+	reasons := make([]string, 0, len(r.skipped))
+	for reason := range r.skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	ui.PrintSection(fmt.Sprintf("Skipped %d entries", r.count()))
+	for _, reason := range reasons {
+		paths := r.skipped[reason]
+		if verbose {
+			ui.PrintInfo(fmt.Sprintf("%s (%d): %s", reason, len(paths), strings.Join(paths, ", ")))
+		} else {
+			ui.PrintInfo(fmt.Sprintf("%s: %d (%s)", reason, len(paths), summarizeFileList(strings.Join(paths, ", "))))
+		}
+	}
+}
+
+// specialFileKind names the type of entries that can't be synced: sockets,
+// named pipes and device nodes. It returns "" for files, directories and links.
+func specialFileKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeDevice != 0, mode&os.ModeCharDevice != 0:
+		return "device node"
+	case mode&os.ModeIrregular != 0:
+		return "irregular file"
+	default:
+		return ""
+	}
+}
+
+// walkConfig walks root, a directory inside the config directory, applying the
+// symlink policies. Followed directory links are descended into, except when
+// they point back to one of their ancestors. Sockets, named pipes and device
+// nodes are never passed to fn; included ones are recorded in report, which may be nil.
+func (m *Manager) walkConfig(root string, report *skipReport, fn walkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	return m.walkDir(root, realRoot, info, map[string]bool{realRoot: true}, report, fn)
+}
+
+// walkDir visits path and, if it is a directory, its contents. ancestors holds
+// the resolved paths of the directories currently being walked.
+func (m *Manager) walkDir(path, realPath string, info os.FileInfo, ancestors map[string]bool, report *skipReport, fn walkFunc) error {
+	relPath, err := filepath.Rel(m.ConfigDir, path)
+	if err != nil {
+		return fmt.Errorf("failed to get relative path: %w", err)
+	}
+
+	if relPath != "." {
+		err = fn(relPath, path, info)
+		if err == filepath.SkipDir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		childPath := filepath.Join(path, entry.Name())
+		childReal := filepath.Join(realPath, entry.Name())
+		childRel := filepath.Join(relPath, entry.Name())
+
+		childInfo, err := os.Lstat(childPath)
+		if os.IsNotExist(err) {
+			// Removed while we were walking
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if childInfo.Mode()&os.ModeSymlink != 0 {
+			switch m.symlinkPolicy(childRel) {
+			case SymlinkSkip:
+				if m.Verbose {
+					ui.PrintInfo(fmt.Sprintf("Skipping symlink %s (symlink policy)", childRel))
+				}
+				if m.shouldInclude(childRel, childInfo.IsDir()) {
+					report.add("symlink policy", childRel)
+				}
+				continue
+
+			case SymlinkFollow:
+				targetInfo, err := os.Stat(childPath)
+				if err != nil {
+					if m.Verbose {
+						ui.PrintInfo(fmt.Sprintf("Skipping dangling symlink %s", childRel))
+					}
+					if m.shouldInclude(childRel, childInfo.IsDir()) {
+						report.add("dangling symlink", childRel)
+					}
+					continue
+				}
+
+				if targetInfo.IsDir() {
+					childReal, err = filepath.EvalSymlinks(childPath)
+					if err != nil {
+						continue
+					}
+
+					if ancestors[childReal] {
+						ui.PrintWarning(fmt.Sprintf("Skipping symlink %s: it points back to %s and would loop forever", childRel, childReal))
+						report.add("symlink loop", childRel)
+						continue
+					}
+				}
+				childInfo = targetInfo
+			}
+		}
+
+		// Reading a FIFO blocks and devices have no content worth syncing
+		if kind := specialFileKind(childInfo.Mode()); kind != "" {
+			if m.Verbose {
+				ui.PrintInfo(fmt.Sprintf("Skipping %s %s", kind, childRel))
+			}
+			if m.shouldInclude(childRel, childInfo.IsDir()) {
+				report.add(kind, childRel)
+			}
+			continue
+		}
+
+		if !childInfo.IsDir() {
+			err = m.walkDir(childPath, childReal, childInfo, ancestors, report, fn)
+		} else {
+			ancestors[childReal] = true
+			err = m.walkDir(childPath, childReal, childInfo, ancestors, report, fn)
+			delete(ancestors, childReal)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"config_handler/ui"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher delivers file system events for the directories added to it.
+// Like inotify, each directory is watched on its own and events are reported
+// for its entries. Events and errors use the fsnotify types whichever
+// backend is in use.
+type Watcher interface {
+	Add(path string) error
+	Remove(path string) error
+	WatchList() []string
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+	// Name is the backend in use
+	Name() string
+	// Usage returns the number of directories watched with inotify and polled
+	Usage() (watched, polled int)
+}
+
+// Watcher backends
+const (
+	// BackendAuto polls on network and FUSE file systems, and polls the
+	// directories beyond the inotify watch budget; it uses fsnotify otherwise
+	BackendAuto = "auto"
+	// BackendFsnotify uses the operating system's change notifications
+	BackendFsnotify = "fsnotify"
+	// BackendPoll compares directory listings at PollInterval
+	BackendPoll = "poll"
+)
+
+// DefaultPollInterval is how often the polling backend scans, unless the
+// manager is given another interval
+const DefaultPollInterval = 5 * time.Second
+
+// newWatcher creates the watcher for the configured backend, given the number
+// of directories it needs to watch. Automatic selection polls on file systems
+// that don't report changes to inotify and polls the directories that don't
+// fit into the inotify watch budget.
+func (m *Manager) newWatcher(needed int) (Watcher, error) {
+	switch m.WatcherBackend {
+	case BackendPoll:
+		return newPollingWatcher(m.PollInterval), nil
+	case BackendFsnotify:
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		return &fsnotifyWatcher{watcher}, nil
+	}
+
+	if fsType, ok := unwatchableFilesystem(m.ConfigDir); ok {
+		ui.PrintWarning(fmt.Sprintf("%s is on %s, which doesn't report changes; polling every %s instead", m.ConfigDir, fsType, m.PollInterval))
+		return newPollingWatcher(m.PollInterval), nil
+	}
+
+	budget, limit := inotifyBudget()
+	if budget >= 0 && needed > budget {
+		ui.PrintWarning(fmt.Sprintf("%d directories need watching but only %d inotify watches are available (fs.inotify.max_user_watches is %d); polling the other %d every %s",
+			needed, budget, limit, needed-budget, m.PollInterval))
+	}
+	return newBudgetWatcher(budget, m.PollInterval)
+}
+
+// isWatchLimit reports whether adding a watch failed because the inotify
+// watch limit (fs.inotify.max_user_watches) is exhausted
+func isWatchLimit(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// watchError explains a failure to add a watch when the inotify limit is the
+// cause, since the system error alone ("no space left on device") misleads
+func watchError(err error) error {
+	if isWatchLimit(err) {
+		return fmt.Errorf("%w (inotify watch limit reached; raise fs.inotify.max_user_watches or use the poll backend)", err)
+	}
+	return err
+}
+
+// fsnotifyWatcher is the Watcher backed by fsnotify
+type fsnotifyWatcher struct {
+	watcher *fsnotify.Watcher
+}
+
+func (w *fsnotifyWatcher) Add(path string) error         { return w.watcher.Add(path) }
+func (w *fsnotifyWatcher) Remove(path string) error      { return w.watcher.Remove(path) }
+func (w *fsnotifyWatcher) WatchList() []string           { return w.watcher.WatchList() }
+func (w *fsnotifyWatcher) Events() <-chan fsnotify.Event { return w.watcher.Events }
+func (w *fsnotifyWatcher) Errors() <-chan error          { return w.watcher.Errors }
+func (w *fsnotifyWatcher) Close() error                  { return w.watcher.Close() }
+func (w *fsnotifyWatcher) Name() string                  { return "fsnotify" }
+func (w *fsnotifyWatcher) Usage() (int, int)             { return len(w.watcher.WatchList()), 0 }
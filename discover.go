@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"config_handler/cli"
+	"config_handler/discover"
+	"config_handler/presets"
+	"config_handler/ui"
+)
+
+// chooseRules scans the config directory, lets the user pick what to sync
+// from the suggestions and stores the choice in appConfig. It returns false
+// if the user cancelled or nothing could be scanned.
+func chooseRules(appConfig *cli.AppConfig) bool {
+	catalog := presets.NewCatalog(appConfig.CustomPresets)
+
+	ui.PrintInfo("Scanning " + appConfig.ConfigDir + "...")
+	suggestions, err := discover.Scan(appConfig.ConfigDir, catalog)
+	if err != nil {
+		ui.PrintError("Failed to scan the config directory: " + err.Error())
+		return false
+	}
+	if len(suggestions) == 0 {
+		ui.PrintWarning("Nothing found in " + appConfig.ConfigDir)
+		return false
+	}
+
+	// Start from what is synced now, or from the suggestions on first run
+	configured := len(appConfig.Presets) > 0 || len(appConfig.IncludePatterns) > 0
+	choices := make([]string, len(suggestions))
+	defaults := make([]bool, len(suggestions))
+	for i, suggestion := range suggestions {
+		choices[i] = suggestion.Summary()
+		if configured {
+			defaults[i] = (suggestion.Preset != "" && slices.Contains(appConfig.Presets, suggestion.Preset)) ||
+				slices.ContainsFunc(appConfig.IncludePatterns, func(pattern string) bool { return coversEntry(pattern, suggestion.Name) })
+		} else {
+			defaults[i] = suggestion.Track
+		}
+	}
+
+	checked, ok := ui.PromptChecklist("Select the applications to sync", choices, defaults)
+	if !ok {
+		ui.PrintInfo("Discovery cancelled; configuration left unchanged")
+		return false
+	}
+
+	// Merge the choice into the current patterns: unchecked entries lose their
+	// include patterns and presets, anything no suggestion covers is kept.
+	// Excludes stay, since excluding something that isn't synced is harmless.
+	wantedPresets := make(map[string]bool)
+	for i, suggestion := range suggestions {
+		if checked[i] && suggestion.Preset != "" {
+			wantedPresets[suggestion.Preset] = true
+		}
+	}
+	dropped := func(covers func(suggestion discover.Suggestion) bool) bool {
+		for i, suggestion := range suggestions {
+			if !checked[i] && covers(suggestion) {
+				return true
+			}
+		}
+		return false
+	}
+
+	selectedPresets := slices.DeleteFunc(slices.Clone(appConfig.Presets), func(name string) bool {
+		return !wantedPresets[name] && dropped(func(suggestion discover.Suggestion) bool { return suggestion.Preset == name })
+	})
+	include := slices.DeleteFunc(slices.Clone(appConfig.IncludePatterns), func(pattern string) bool {
+		return dropped(func(suggestion discover.Suggestion) bool { return coversEntry(pattern, suggestion.Name) })
+	})
+	exclude := slices.Clone(appConfig.ExcludePatterns)
+
+	for i, suggestion := range suggestions {
+		if !checked[i] {
+			continue
+		}
+
+		// Exclude-only presets are kept as presets; other entries are synced
+		// through their preset when they have one
+		preset, isPreset := catalog.Get(suggestion.Preset)
+		switch {
+		case isPreset && len(preset.Include) > 0:
+			if !slices.Contains(selectedPresets, preset.Name) {
+				selectedPresets = append(selectedPresets, preset.Name)
+			}
+		case !slices.ContainsFunc(include, func(pattern string) bool { return coversEntry(pattern, suggestion.Name) }):
+			include = append(include, suggestion.Name)
+		}
+
+		for _, pattern := range suggestion.Exclude {
+			if !slices.Contains(exclude, pattern) {
+				exclude = append(exclude, pattern)
+			}
+		}
+	}
+
+	if len(selectedPresets) == 0 && len(include) == 0 {
+		ui.PrintWarning("Nothing selected; configuration left unchanged")
+		return false
+	}
+
+	appConfig.Presets = selectedPresets
+	appConfig.IncludePatterns = include
+	appConfig.ExcludePatterns = exclude
+
+	ui.PrintSuccess(fmt.Sprintf("Selected %d presets and %d other paths", len(selectedPresets), len(include)))
+	return true
+}
+
+// coversEntry reports whether a pattern is about a top-level entry of the
+// config directory: the entry itself or a path inside it
+func coversEntry(pattern, name string) bool {
+	return pattern == name || strings.HasPrefix(pattern, name+"/")
+}
+
+// runDiscoverCommand suggests what to sync and writes the choice to the config file
+func runDiscoverCommand(appConfig *cli.AppConfig) int {
+	if !chooseRules(appConfig) {
+		return 1
+	}
+
+	if err := cli.SavePatterns(appConfig); err != nil {
+		ui.PrintError("Failed to save the configuration: " + err.Error())
+		return 1
+	}
+
+	ui.PrintSuccess("Saved presets and patterns to " + appConfig.ConfigFile)
+	return 0
+}
@@ -0,0 +1,221 @@
+// Package discover scans a config directory and suggests which applications to sync
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"config_handler/presets"
+)
+
+// Thresholds above which a directory is considered data rather than configuration
+const (
+	maxConfigSize  = 20 << 20 // 20 MiB
+	maxConfigFiles = 1000
+	// A directory where more than this share of files changed within churnWindow is volatile
+	maxChurnPercent = 50
+	churnWindow     = 24 * time.Hour
+)
+
+// cacheNames are directory names that hold caches in Electron, Chromium and other apps
+var cacheNames = map[string]bool{
+	"cache": true, "Cache": true, "caches": true, "CachedData": true, "Code Cache": true,
+	"GPUCache": true, "DawnCache": true, "ShaderCache": true, "GrShaderCache": true,
+	"Service Worker": true, "blob_storage": true, "logs": true, "Crashpad": true,
+}
+
+// Suggestion describes a top-level entry of the config directory and whether to sync it
+type Suggestion struct {
+	Name   string
+	Preset string // Preset covering the entry, if any
+	Track  bool   // Whether syncing it is recommended
+	Reason string
+
+	// Exclude lists volatile paths found inside an entry worth tracking
+	Exclude []string
+
+	Size  int64
+	Files int
+}
+
+// stats summarizes the contents of a directory
+type stats struct {
+	size      int64
+	files     int
+	databases int
+	recent    int
+	volatile  []string
+}
+
+// Scan classifies the top-level entries of configDir
+func Scan(configDir string, catalog *presets.Catalog) ([]Suggestion, error) {
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var suggestions []Suggestion
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == ".git" || entry.Type()&fs.ModeSymlink != 0 {
+			continue
+		}
+
+		st := scanEntry(filepath.Join(configDir, name), name, now)
+		suggestion := Suggestion{Name: name, Size: st.size, Files: st.files}
+		classify(&suggestion, st, catalog)
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		return strings.ToLower(suggestions[i].Name) < strings.ToLower(suggestions[j].Name)
+	})
+	return suggestions, nil
+}
+
+// classify applies the heuristics in order of confidence: presets first,
+// then what the contents look like
+func classify(s *Suggestion, st stats, catalog *presets.Catalog) {
+	for _, preset := range catalog.All() {
+		if len(preset.Include) > 0 && coversEntry(preset.Include, s.Name) {
+			s.Preset, s.Track, s.Reason = preset.Name, true, "known application ("+preset.Description+")"
+			return
+		}
+	}
+
+	for _, preset := range catalog.All() {
+		if len(preset.Include) == 0 && coversEntry(preset.Exclude, s.Name) {
+			s.Preset, s.Reason = preset.Name, strings.ToLower(strings.TrimPrefix(preset.Description, "Exclude "))
+			return
+		}
+	}
+
+	switch {
+	case cacheNames[s.Name]:
+		s.Reason = "cache directory"
+	case st.databases > 0:
+		s.Reason = "application state (SQLite/LevelDB databases)"
+	case st.size > maxConfigSize:
+		s.Reason = "large (" + formatSize(st.size) + ")"
+	case st.files > maxConfigFiles:
+		s.Reason = "many files"
+	case st.files >= 10 && st.recent*100 > st.files*maxChurnPercent:
+		s.Reason = "changes constantly"
+	case st.files == 0 && st.size == 0:
+		s.Reason = "empty"
+	default:
+		s.Track, s.Reason = true, "small configuration"
+		s.Exclude = st.volatile
+	}
+}
+
+// coversEntry reports whether a pattern list names a top-level entry directly
+// or as the first component of a longer path
+func coversEntry(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		first, _, _ := strings.Cut(pattern, "/")
+		if first == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scanEntry collects size, file count, databases and recently changed files
+// below path. Cache directories and databases inside it are noted as volatile.
+func scanEntry(path, relPath string, now time.Time) stats {
+	var st stats
+
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		rel := relPath
+		if p != path {
+			rel = filepath.Join(relPath, strings.TrimPrefix(p, path+string(filepath.Separator)))
+		}
+
+		if d.IsDir() {
+			if p != path && cacheNames[d.Name()] {
+				st.volatile = append(st.volatile, filepath.ToSlash(rel))
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		st.files++
+		st.size += info.Size()
+		if now.Sub(info.ModTime()) < churnWindow {
+			st.recent++
+		}
+
+		if isDatabase(p, d.Name()) {
+			st.databases++
+			st.volatile = append(st.volatile, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	return st
+}
+
+// isDatabase recognizes SQLite files by their header and LevelDB stores by
+// their file names
+func isDatabase(path, name string) bool {
+	if strings.HasSuffix(name, ".ldb") || strings.HasPrefix(name, "MANIFEST-") {
+		return true
+	}
+
+	if !strings.HasSuffix(name, ".db") && !strings.HasSuffix(name, ".sqlite") && !strings.HasSuffix(name, ".sqlite3") {
+		return false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, []byte("SQLite format 3\x00"))
+}
+
+// Summary describes the suggestion in one line
+func (s Suggestion) Summary() string {
+	return fmt.Sprintf("%s: %s (%d files, %s)", s.Name, s.Reason, s.Files, formatSize(s.Size))
+}
+
+// formatSize renders a byte count for display
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"config_handler/ui"
@@ -27,6 +28,18 @@ type GitRepo struct {
 	Path       string
 	RemoteURL  string
 	Auth       *http.BasicAuth
+
+	// GitDir is set for in-place repositories, whose git directory is kept
+	// apart from the work tree at Path
+	GitDir string
+
+	// mu serializes SyncWithRemote and TrackedFiles for managers sharing the repository
+	mu sync.Mutex
+
+	// workTree is held by a root while it changes the work tree and commits;
+	// workTreeFile holds the lock on the work tree for other processes
+	workTree     sync.Mutex
+	workTreeFile *os.File
 }
 
 // InitOrOpenRepo initializes a new git repository or opens an existing one
@@ -118,21 +131,83 @@ func (g *GitRepo) Add(paths ...string) error {
 	return nil
 }
 
-// Commit commits staged changes to the repository
-func (g *GitRepo) Commit(message string) error {
+// AddDirs stages everything below each of dirs, where an empty one stands for
+// the whole work tree. Directories that no longer exist stage the removal of
+// the files they held.
+func (g *GitRepo) AddDirs(dirs ...string) error {
 	w, err := g.Repository.Worktree()
 	if err != nil {
 		return fmt.Errorf("failed to get worktree: %w", err)
 	}
 
-	// Check if there are changes to commit
-	status, err := w.Status()
+	for _, dir := range dirs {
+		dir = filepath.ToSlash(filepath.Clean(dir))
+		if _, err := w.Filesystem.Lstat(dir); err == nil {
+			if _, err := w.Add(dir); err != nil {
+				return fmt.Errorf("failed to add directory %s: %w", dir, err)
+			}
+			continue
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to add directory %s: %w", dir, err)
+		}
+
+		// go-git only stages a removed directory file by file
+		idx, err := g.Repository.Storer.Index()
+		if err != nil {
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+		var removed []string
+		for _, entry := range idx.Entries {
+			if strings.HasPrefix(entry.Name, dir+"/") {
+				removed = append(removed, entry.Name)
+			}
+		}
+		for _, path := range removed {
+			if _, err := w.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove file %s: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// TrackedFiles returns the paths of all files recorded in the repository index
+func (g *GitRepo) TrackedFiles() ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	idx, err := g.Repository.Storer.Index()
 	if err != nil {
-		return fmt.Errorf("failed to get status: %w", err)
+		return nil, fmt.Errorf("failed to read index: %w", err)
 	}
 
-	if status.IsClean() {
-		return errors.New("no changes to commit")
+	files := make([]string, 0, len(idx.Entries))
+	for _, entry := range idx.Entries {
+		files = append(files, filepath.FromSlash(entry.Name))
+	}
+
+	return files, nil
+}
+
+// Commit commits staged changes to the repository
+func (g *GitRepo) Commit(message string) error {
+	w, err := g.Repository.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	// Check if there are changes to commit. The status of an in-place work
+	// tree is mostly untracked files, so there only the commit itself can tell.
+	if !g.InPlace() {
+		status, err := w.Status()
+		if err != nil {
+			return fmt.Errorf("failed to get status: %w", err)
+		}
+
+		if status.IsClean() {
+			return errors.New("no changes to commit")
+		}
 	}
 
 	ui.PrintInfo("Committing changes: " + ui.FormatCommitMessage(message))
@@ -143,7 +218,9 @@ func (g *GitRepo) Commit(message string) error {
 			When:  time.Now(),
 		},
 	})
-	if err != nil {
+	if errors.Is(err, git.ErrEmptyCommit) {
+		return errors.New("no changes to commit")
+	} else if err != nil {
 		return fmt.Errorf("failed to commit: %w", err)
 	}
 
@@ -197,6 +274,22 @@ func (g *GitRepo) Pull() error {
 
 // SyncWithRemote syncs local changes with the remote repository
 func (g *GitRepo) SyncWithRemote(message string) error {
+	return g.SyncDirsWithRemote([]string{"."}, message)
+}
+
+// SyncDirWithRemote syncs the local changes below dir with the remote
+// repository, so that roots sharing the repository commit only their own files
+func (g *GitRepo) SyncDirWithRemote(dir, message string) error {
+	return g.SyncDirsWithRemote([]string{dir}, message)
+}
+
+// SyncDirsWithRemote syncs the local changes below each of dirs with the
+// remote repository. The directories are relative to the top of the work
+// tree, where an empty one stands for the whole work tree.
+func (g *GitRepo) SyncDirsWithRemote(dirs []string, message string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	// Try to pull latest changes first
 	err := g.Pull()
 	if err != nil && err != git.NoErrAlreadyUpToDate {
@@ -258,10 +351,11 @@ func (g *GitRepo) SyncWithRemote(message string) error {
 		}
 	}
 
-	// Add all changes
-	err = g.Add(".")
-	if err != nil {
-		return fmt.Errorf("failed to add changes: %w", err)
+	// Add the changes (in-place repositories have them staged already)
+	if !g.InPlace() {
+		if err := g.AddDirs(dirs...); err != nil {
+			return fmt.Errorf("failed to add changes: %w", err)
+		}
 	}
 
 	// Commit changes
@@ -283,6 +377,35 @@ func (g *GitRepo) SyncWithRemote(message string) error {
 	return nil
 }
 
+// workTreeLockFile is the file in the git directory that processes sharing
+// the work tree lock
+const workTreeLockFile = "config_handler.lock"
+
+// LockWorkTree keeps the other roots sharing the repository, and other
+// processes such as the track command, from changing the work tree until
+// UnlockWorkTree, so that a root's batch is copied and committed as a whole
+func (g *GitRepo) LockWorkTree() {
+	g.workTree.Lock()
+	g.workTreeFile = lockFile(filepath.Join(g.gitDir(), workTreeLockFile))
+}
+
+// UnlockWorkTree releases the work tree locked by LockWorkTree
+func (g *GitRepo) UnlockWorkTree() {
+	if g.workTreeFile != nil {
+		g.workTreeFile.Close()
+		g.workTreeFile = nil
+	}
+	g.workTree.Unlock()
+}
+
+// gitDir returns the repository's git directory
+func (g *GitRepo) gitDir() string {
+	if g.GitDir != "" {
+		return g.GitDir
+	}
+	return filepath.Join(g.Path, ".git")
+}
+
 // ResolutionStrategy defines how to resolve conflicts
 type ResolutionStrategy string
 
@@ -460,6 +583,10 @@ func (g *GitRepo) execGitCheckout(path string, option string) error {
 	// Create a temporary script to execute the checkout command
 	scriptContent := fmt.Sprintf("cd %s && git checkout %s -- %s",
 		g.Path, option, path)
+	if g.InPlace() {
+		scriptContent = fmt.Sprintf("cd %s && git --git-dir=%s --work-tree=%s checkout %s -- %s",
+			g.Path, g.GitDir, g.Path, option, path)
+	}
 
 	tempFile := filepath.Join(os.TempDir(), "git_checkout.sh")
 	err := os.WriteFile(tempFile, []byte(scriptContent), 0700)
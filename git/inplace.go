@@ -0,0 +1,202 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"config_handler/ui"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// InitOrOpenInPlaceRepo initializes or opens a repository whose git directory
+// is kept apart from its work tree, so files are tracked where they are
+// instead of being copied. Only paths passed to Stage are ever committed.
+func InitOrOpenInPlaceRepo(gitDir, workTree string) (*GitRepo, error) {
+	if _, err := os.Stat(filepath.Join(gitDir, ".git")); err == nil {
+		return nil, fmt.Errorf("%s holds a repository with its own work tree; use another directory for in-place mode", gitDir)
+	}
+
+	storage := filesystem.NewStorage(osfs.New(gitDir), cache.NewObjectLRUDefault())
+	worktree := osfs.New(workTree)
+
+	var repo *git.Repository
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); os.IsNotExist(err) {
+		if err := os.MkdirAll(gitDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create git directory: %w", err)
+		}
+
+		ui.PrintInfo("Creating new Git repository at " + gitDir + " for " + workTree)
+		repo, err = git.Init(storage, worktree)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize repository: %w", err)
+		}
+
+		// Record the work tree in the repository config, and keep git status
+		// readable by hiding the untracked files, as yadm does
+		cfg, err := repo.Config()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read repository config: %w", err)
+		}
+		cfg.Core.Worktree = workTree
+		cfg.Raw.Section("status").SetOption("showUntrackedFiles", "no")
+		if err := repo.SetConfig(cfg); err != nil {
+			return nil, fmt.Errorf("failed to write repository config: %w", err)
+		}
+	} else {
+		ui.PrintInfo("Opening existing Git repository at " + gitDir + " for " + workTree)
+		repo, err = git.Open(storage, worktree)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open repository: %w", err)
+		}
+	}
+
+	return &GitRepo{
+		Repository: repo,
+		Path:       workTree,
+		GitDir:     gitDir,
+	}, nil
+}
+
+// InPlace reports whether the repository tracks its work tree in place
+func (g *GitRepo) InPlace() bool {
+	return g.GitDir != ""
+}
+
+// Stage updates the index for the given files: existing files are added and
+// missing ones removed. Unlike Add it never scans the rest of the work tree.
+func (g *GitRepo) Stage(paths ...string) error {
+	w, err := g.Repository.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	var missing []string
+	for _, path := range paths {
+		if _, err := os.Lstat(filepath.Join(g.Path, path)); os.IsNotExist(err) {
+			missing = append(missing, path)
+			continue
+		}
+
+		err := w.AddWithOptions(&git.AddOptions{Path: filepath.ToSlash(path), SkipStatus: true})
+		if err != nil {
+			return fmt.Errorf("failed to add file %s: %w", path, err)
+		}
+	}
+
+	return g.Unstage(missing...)
+}
+
+// Unstage removes files from the index, leaving the work tree alone
+func (g *GitRepo) Unstage(paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	idx, err := g.Repository.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	for _, path := range paths {
+		if _, err := idx.Remove(filepath.ToSlash(path)); err != nil && !errors.Is(err, index.ErrEntryNotFound) {
+			return fmt.Errorf("failed to remove %s from the index: %w", path, err)
+		}
+	}
+
+	return g.Repository.Storer.SetIndex(idx)
+}
+
+// HeadFile opens a file as it was last committed, returning its mode too
+func (g *GitRepo) HeadFile(path string) (io.ReadCloser, os.FileMode, error) {
+	head, err := g.Repository.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// Nothing has been committed yet
+		return nil, 0, os.ErrNotExist
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+
+	commit, err := g.Repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read commit: %w", err)
+	}
+
+	file, err := commit.File(filepath.ToSlash(path))
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, 0, os.ErrNotExist
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	mode, err := file.Mode.ToOSFileMode()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, mode, nil
+}
+
+// ModifiedFiles returns the files in the index whose work tree version
+// differs from the staged one. Contents are only hashed when the size or
+// modification time differs from the index entry.
+func (g *GitRepo) ModifiedFiles() ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	idx, err := g.Repository.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	var modified []string
+	for _, entry := range idx.Entries {
+		path := filepath.Join(g.Path, filepath.FromSlash(entry.Name))
+		info, err := os.Lstat(path)
+		if err != nil {
+			// Deleted files are not modifications
+			continue
+		}
+		if info.Size() == int64(entry.Size) && info.ModTime().Equal(entry.ModifiedAt) {
+			continue
+		}
+
+		hash, err := blobHash(path, info)
+		if err != nil || hash != entry.Hash {
+			modified = append(modified, filepath.FromSlash(entry.Name))
+		}
+	}
+
+	return modified, nil
+}
+
+// blobHash computes the git object hash of a file or a link
+func blobHash(path string, info os.FileInfo) (plumbing.Hash, error) {
+	var content []byte
+	var err error
+	if info.Mode()&os.ModeSymlink != 0 {
+		var target string
+		target, err = os.Readlink(path)
+		content = []byte(target)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return plumbing.ComputeHash(plumbing.BlobObject, content), nil
+}
@@ -0,0 +1,25 @@
+//go:build unix && !aix
+
+package git
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile takes an exclusive lock on path, waiting for other processes to
+// release it. It returns the file holding the lock, or nil if the lock
+// couldn't be taken, in which case only this process is serialized.
+func lockFile(path string) *os.File {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil
+	}
+
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX); err != nil {
+		file.Close()
+		return nil
+	}
+	return file
+}
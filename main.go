@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
 
 	"config_handler/cli"
 	"config_handler/config"
 	"config_handler/env"
 	"config_handler/git"
 	"config_handler/notification"
+	"config_handler/state"
 	"config_handler/ui"
 )
 
@@ -21,6 +26,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Run a one-off command if one was given after the flags
+	if len(appConfig.Args) > 0 {
+		os.Exit(runCommand(appConfig))
+	}
+
+	// Refuse to start with a broken configuration
+	if problems := validateConfig(appConfig); len(problems) > 0 {
+		printProblems(problems)
+		if cli.HasErrors(problems) {
+			ui.PrintError("Fix the configuration and try again (run the validate command for details)")
+			os.Exit(1)
+		}
+	}
+
 	// Display application logo and title
 	ui.PrintLogo()
 	ui.PrintTitle("Linux Configuration Manager")
@@ -45,7 +64,7 @@ func main() {
 
 	// Initialize git repository if it doesn't exist
 	ui.PrintInfo("Initializing local repository...")
-	gitRepo, err := git.InitOrOpenRepo(appConfig.RepoDir)
+	gitRepo, err := initRepository(appConfig)
 	if err != nil {
 		ui.PrintError("Failed to initialize repository: " + err.Error())
 		os.Exit(1)
@@ -94,6 +113,13 @@ func main() {
 
 	// Apply configuration to Git repository
 	if envConfig.GithubRepoURL != "" {
+		if problems := cli.ValidateRemote(envConfig.GithubRepoURL); len(problems) > 0 {
+			printProblems(problems)
+			if cli.HasErrors(problems) {
+				os.Exit(1)
+			}
+		}
+
 		ui.PrintInfo("Setting up GitHub remote...")
 		err = gitRepo.SetRemote(envConfig.GithubRepoURL)
 		if err != nil {
@@ -113,13 +139,23 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Save configuration to file
-	ui.PrintInfo("Saving application configuration...")
-	err = cli.SaveConfig(appConfig)
-	if err != nil {
-		ui.PrintWarning("Could not save application configuration: " + err.Error())
-	} else {
-		ui.PrintSuccess("Application configuration saved successfully")
+	// Write a config file with the effective settings on first run, offering
+	// to pick what to sync unless patterns were given as flags
+	if _, err := os.Stat(appConfig.ConfigFile); os.IsNotExist(err) {
+		if len(appConfig.Presets) == 0 && len(appConfig.IncludePatterns) == 0 && len(appConfig.ExcludePatterns) == 0 {
+			ui.PrintSection("First Run")
+			if ui.PromptYesNo("Scan "+appConfig.ConfigDir+" and choose which applications to sync?", true) {
+				chooseRules(appConfig)
+			}
+		}
+
+		ui.PrintInfo("Saving application configuration...")
+		err = cli.SaveConfig(appConfig)
+		if err != nil {
+			ui.PrintWarning("Could not save application configuration: " + err.Error())
+		} else {
+			ui.PrintSuccess("Application configuration saved to " + appConfig.ConfigFile)
+		}
 	}
 
 	// Show effective configuration if verbose
@@ -127,7 +163,23 @@ func main() {
 		ui.PrintSection("Effective Configuration")
 		ui.PrintInfo("Configuration Directory: " + appConfig.ConfigDir)
 		ui.PrintInfo("Repository Directory: " + appConfig.RepoDir)
-		ui.PrintInfo("Sync Interval: " + appConfig.SyncInterval.String())
+		if appConfig.RepoPrefix != "" {
+			ui.PrintInfo("Repository Prefix: " + appConfig.RepoPrefix)
+		}
+		ui.PrintInfo("Mode: " + appConfig.Mode)
+		ui.PrintInfo("Maintenance Interval: " + appConfig.MaintenanceInterval.String())
+		ui.PrintInfo("Quiet Period: " + appConfig.QuietPeriod.String())
+		ui.PrintInfo("Max Latency: " + appConfig.MaxLatency.String())
+		ui.PrintInfo(fmt.Sprintf("Storm Threshold: %d changes within %s", appConfig.StormThreshold, appConfig.StormWindow))
+		ui.PrintInfo("Rescan Interval: " + appConfig.RescanInterval.String())
+		ui.PrintInfo(fmt.Sprintf("Watcher Backend: %s (polling every %s)", appConfig.WatcherBackend, appConfig.PollInterval))
+		ui.PrintInfo("Shutdown Timeout: " + appConfig.ShutdownTimeout.String())
+		ui.PrintInfo(fmt.Sprintf("Max Delete Percent: %d%%", appConfig.MaxDeletePercent))
+		ui.PrintInfo("Trash Grace Period: " + appConfig.TrashGracePeriod.String())
+
+		if len(appConfig.Presets) > 0 {
+			ui.PrintInfo("Presets: " + strings.Join(appConfig.Presets, ", "))
+		}
 
 		if len(appConfig.IncludePatterns) > 0 {
 			ui.PrintInfo("Include Patterns: " + strings.Join(appConfig.IncludePatterns, ", "))
@@ -137,58 +189,211 @@ func main() {
 			ui.PrintInfo("Exclude Patterns: " + strings.Join(appConfig.ExcludePatterns, ", "))
 		}
 
+		for _, root := range appConfig.Roots {
+			ui.PrintInfo(fmt.Sprintf("Root: %s → %s/", root.Source, root.Target))
+		}
+
 		ui.PrintInfo(fmt.Sprintf("Operation Mode: %s", getOperationMode(appConfig)))
 	}
 
-	// Setup config manager
-	configManager := config.NewManager(
-		appConfig.ConfigDir,
-		appConfig.RepoDir,
-		gitRepo,
-		appConfig.IncludePatterns,
-		appConfig.ExcludePatterns,
-		appConfig.SyncInterval,
-		appConfig.Verbose,
-		notifyManager,
-	)
+	// Setup a config manager for each source root
+	configManagers, err := newConfigManagers(appConfig, gitRepo, notifyManager)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		os.Exit(1)
+	}
+
+	// Apply edits to the config file while running
+	for _, configManager := range configManagers {
+		root := config.Root{Source: configManager.ConfigDir, Prefix: configManager.RepoPrefix}
+		configManager.ConfigFile = appConfig.ConfigFile
+		configManager.Interactive = appConfig.RunOnce || appConfig.SyncOnly
+		configManager.LoadConfig = func() (*config.Manager, error) {
+			return reloadConfigManager(appConfig, root)
+		}
+	}
 
 	// Do initial sync
 	ui.PrintSection("Initial Synchronization")
 	ui.PrintProgress("Performing initial sync of configuration files", 3)
 
-	err = configManager.InitialSync()
-	if err != nil {
-		ui.PrintError("Failed during initial sync: " + err.Error())
-		os.Exit(1)
+	for _, configManager := range configManagers {
+		if len(configManagers) > 1 {
+			ui.PrintInfo("Syncing " + configManager.ConfigDir)
+		}
+
+		err = configManager.InitialSync()
+		if err != nil {
+			ui.PrintError("Failed during initial sync of " + configManager.ConfigDir + ": " + err.Error())
+			os.Exit(1)
+		}
 	}
 	ui.PrintSuccess("Initial sync completed successfully!")
 
 	// If run-once flag is set, exit after initial sync
 	if appConfig.RunOnce {
 		ui.PrintInfo("Run-once flag set. Exiting after initial sync.")
+		if notifyManager != nil {
+			notifyManager.Close()
+		}
 		os.Exit(0)
 	}
 
 	// If sync-only flag is set, exit after initial sync
 	if appConfig.SyncOnly {
 		ui.PrintInfo("Sync-only flag set. Exiting after initial sync.")
+		if notifyManager != nil {
+			notifyManager.Close()
+		}
 		os.Exit(0)
 	}
 
 	// Start file watcher to detect changes
 	ui.PrintSection("File Monitoring")
 	ui.PrintInfo("Starting file watcher for configuration changes...")
-	err = configManager.StartWatcher()
-	if err != nil {
-		ui.PrintError("Failed to start file watcher: " + err.Error())
-		os.Exit(1)
+	for _, configManager := range configManagers {
+		err = configManager.StartWatcher()
+		if err != nil {
+			ui.PrintError("Failed to start file watcher for " + configManager.ConfigDir + ": " + err.Error())
+			os.Exit(1)
+		}
 	}
 	ui.PrintSuccess("File watcher started successfully")
 	ui.PrintSeparator()
 	ui.PrintInfo("Now monitoring for configuration changes. Press Ctrl+C to exit.")
 
-	// Keep the application running
-	select {}
+	// Run until interrupted, then sync what is still pending
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	received := <-signals
+	os.Exit(shutdown(appConfig, configManagers, notifyManager, received, signals))
+}
+
+// shutdown stops the watchers and commits and pushes the pending changes
+// within the shutdown timeout. A second signal exits right away. It returns
+// the exit status, which is non-zero if pending changes weren't synced.
+func shutdown(appConfig *cli.AppConfig, configManagers []*config.Manager, notifyManager *notification.Manager, received os.Signal, signals <-chan os.Signal) int {
+	ui.PrintSeparator()
+	ui.PrintInfo(fmt.Sprintf("Received %s; syncing pending changes before exiting (press Ctrl+C again to exit now)", received))
+
+	go func() {
+		<-signals
+		ui.PrintWarning("Exiting without syncing pending changes")
+		os.Exit(130)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), appConfig.ShutdownTimeout)
+	defer cancel()
+
+	exitCode := 0
+	for _, configManager := range configManagers {
+		if err := configManager.Stop(ctx); err != nil {
+			ui.PrintError("Failed to sync pending changes of " + configManager.ConfigDir + ": " + err.Error())
+			exitCode = 1
+		}
+	}
+
+	if notifyManager != nil {
+		notifyManager.Close()
+	}
+
+	if exitCode == 0 {
+		ui.PrintSuccess("All changes synced. Exiting.")
+	}
+	return exitCode
+}
+
+// newConfigManager creates the config manager of the config directory
+func newConfigManager(appConfig *cli.AppConfig, gitRepo *git.GitRepo, notifyManager *notification.Manager) (*config.Manager, error) {
+	configManagers, err := newConfigManagers(appConfig, gitRepo, notifyManager)
+	if err != nil {
+		return nil, err
+	}
+	return configManagers[0], nil
+}
+
+// newConfigManagers creates a config manager for the config directory
+// followed by one for each further root, all sharing the repository and the
+// state file
+func newConfigManagers(appConfig *cli.AppConfig, gitRepo *git.GitRepo, notifyManager *notification.Manager) ([]*config.Manager, error) {
+	roots, err := appConfig.SourceRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	configRoots := make([]config.Root, 0, len(roots))
+	for _, root := range roots {
+		configRoots = append(configRoots, config.Root{Source: root.Source, Prefix: root.Target})
+	}
+
+	store := state.NewStore(appConfig.StateFile)
+	configManagers := make([]*config.Manager, 0, len(roots))
+	for i, root := range roots {
+		others := slices.Delete(slices.Clone(configRoots), i, i+1)
+
+		configManager, err := newRootManager(appConfig, root, others, gitRepo, notifyManager)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", root.Source, err)
+		}
+		configManager.State = store
+
+		configManagers = append(configManagers, configManager)
+	}
+
+	return configManagers, nil
+}
+
+// newRootManager creates a config manager for one source root
+func newRootManager(appConfig *cli.AppConfig, root cli.Root, others []config.Root, gitRepo *git.GitRepo, notifyManager *notification.Manager) (*config.Manager, error) {
+	configManager := config.NewManager(
+		root.Source,
+		appConfig.RepoDir,
+		gitRepo,
+		root.Include,
+		root.Exclude,
+		appConfig.MaintenanceInterval,
+		appConfig.Verbose,
+		notifyManager,
+	)
+	configManager.SetRoot(appConfig.RepoDir, root.Target, others)
+	configManager.InPlace = appConfig.InPlace()
+	configManager.QuietPeriod = appConfig.QuietPeriod
+	configManager.MaxLatency = appConfig.MaxLatency
+	configManager.StormThreshold = appConfig.StormThreshold
+	configManager.StormWindow = appConfig.StormWindow
+	configManager.RescanInterval = appConfig.RescanInterval
+	configManager.WatcherBackend = appConfig.WatcherBackend
+	configManager.PollInterval = appConfig.PollInterval
+	configManager.MaxDeletePercent = appConfig.MaxDeletePercent
+	configManager.TrashGracePeriod = appConfig.TrashGracePeriod
+	configManager.PreserveXattrs = appConfig.PreserveXattrs
+	configManager.RecordOwnership = appConfig.RecordOwnership
+
+	// Compile the symlink policies
+	defaultPolicy, err := config.ParseSymlinkPolicy(appConfig.SymlinkPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	symlinkRules := make([]config.SymlinkRule, 0, len(appConfig.SymlinkRules))
+	for _, rule := range appConfig.SymlinkRules {
+		symlinkRules = append(symlinkRules, config.SymlinkRule{
+			Pattern: rule.Pattern,
+			Policy:  config.SymlinkPolicy(rule.Policy),
+		})
+	}
+
+	err = configManager.SetSymlinkRules(defaultPolicy, symlinkRules)
+	if err != nil {
+		return nil, err
+	}
+
+	err = configManager.LoadIgnoreFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return configManager, nil
 }
 
 // getOperationMode returns a string describing the current operation mode
@@ -201,3 +406,54 @@ func getOperationMode(config *cli.AppConfig) string {
 		return "Normal (sync and monitor)"
 	}
 }
+
+// reloadConfigManager builds the config manager of a root from the config
+// file as it is now, refusing configurations that fail validation
+func reloadConfigManager(appConfig *cli.AppConfig, root config.Root) (*config.Manager, error) {
+	reloaded, err := cli.ReloadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Paths and the watcher can't change while running
+	if reloaded.ConfigDir != appConfig.ConfigDir || reloaded.RepoDir != appConfig.RepoDir || reloaded.RepoPrefix != appConfig.RepoPrefix || reloaded.StateFile != appConfig.StateFile || reloaded.Mode != appConfig.Mode {
+		ui.PrintWarning("Changes to config_dir, repo_dir, repo_prefix, state_file and mode take effect after a restart")
+	}
+	if reloaded.WatcherBackend != appConfig.WatcherBackend || reloaded.PollInterval != appConfig.PollInterval || reloaded.ShutdownTimeout != appConfig.ShutdownTimeout {
+		ui.PrintWarning("Changes to watcher_backend, poll_interval and shutdown_timeout take effect after a restart")
+	}
+	reloaded.ConfigDir, reloaded.RepoDir, reloaded.RepoPrefix, reloaded.StateFile, reloaded.Mode = appConfig.ConfigDir, appConfig.RepoDir, appConfig.RepoPrefix, appConfig.StateFile, appConfig.Mode
+	reloaded.WatcherBackend, reloaded.PollInterval, reloaded.ShutdownTimeout = appConfig.WatcherBackend, appConfig.PollInterval, appConfig.ShutdownTimeout
+
+	if problems := cli.Validate(reloaded); cli.HasErrors(problems) {
+		messages := make([]string, 0, len(problems))
+		for _, problem := range problems {
+			if !problem.Warning {
+				messages = append(messages, problem.String())
+			}
+		}
+		return nil, fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+
+	// Roots can't be added or moved while running
+	if root.Prefix == "" && !slices.EqualFunc(reloaded.Roots, appConfig.Roots, sameRoot) {
+		ui.PrintWarning("Added, removed or moved roots take effect after a restart")
+	}
+
+	configManagers, err := newConfigManagers(reloaded, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, configManager := range configManagers {
+		if configManager.ConfigDir == root.Source && configManager.RepoPrefix == root.Prefix {
+			return configManager, nil
+		}
+	}
+	return nil, fmt.Errorf("the root %s is no longer configured; restart to stop syncing it", root.Source)
+}
+
+// sameRoot reports whether two roots have the same source and target
+func sameRoot(a, b cli.Root) bool {
+	return a.Source == b.Source && a.Target == b.Target
+}
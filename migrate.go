@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"config_handler/cli"
+	"config_handler/config"
+	"config_handler/git"
+	"config_handler/ui"
+)
+
+// runMigrateCommand moves the config directory's files to another directory
+// of the repository, updates repo_prefix and commits the move. If saving
+// repo_prefix or the commit fails, the files are moved back.
+func runMigrateCommand(appConfig *cli.AppConfig, args []string) int {
+	if len(args) != 1 {
+		ui.PrintError("Usage: migrate <prefix> (use . for the top level of the repository)")
+		return 1
+	}
+
+	prefix := filepath.ToSlash(filepath.Clean(args[0]))
+	if prefix == "." {
+		prefix = ""
+	}
+
+	// Check the new layout before touching anything
+	migrated := *appConfig
+	migrated.RepoPrefix = prefix
+	if problems := cli.Validate(&migrated); cli.HasErrors(problems) {
+		printProblems(problems)
+		return 1
+	}
+
+	gitRepo, err := openRepository(appConfig)
+	if err != nil {
+		ui.PrintError("Failed to open repository: " + err.Error())
+		return 1
+	}
+
+	configManagers, err := newConfigManagers(appConfig, gitRepo, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	// A running instance would go on syncing into the old directory
+	for _, configManager := range configManagers {
+		status, err := configManager.WatcherStatus()
+		if err != nil {
+			ui.PrintError("Failed to read the watcher status: " + err.Error())
+			return 1
+		}
+		if status != nil && processRunning(status.PID) {
+			ui.PrintError(fmt.Sprintf("Process %d is syncing %s; stop it before migrating", status.PID, configManager.ConfigDir))
+			return 1
+		}
+	}
+
+	// Keep other commands from committing the half-moved files
+	configManager := configManagers[0]
+	defer configManager.LockWorkTree()()
+
+	oldPrefix := appConfig.RepoPrefix
+	moved, err := configManager.MovePrefix(prefix)
+	if err != nil {
+		ui.PrintError("Failed to move the files: " + err.Error())
+		return 1
+	}
+
+	// Only the moved entries are staged, since either prefix may be the top
+	// level of the repository that holds the other roots
+	var staged []string
+	for _, name := range moved {
+		ui.PrintFileOperation("renamed", fmt.Sprintf("%s → %s", filepath.Join(oldPrefix, name), filepath.Join(prefix, name)))
+		staged = append(staged, filepath.Join(oldPrefix, name), filepath.Join(prefix, name))
+	}
+
+	appConfig.RepoPrefix = prefix
+	if err := cli.SaveRepoPrefix(appConfig); err != nil {
+		ui.PrintError("Failed to save repo_prefix: " + err.Error())
+		undoMigrate(appConfig, configManager, nil, oldPrefix, nil)
+		return 1
+	}
+	ui.PrintSuccess("Updated repo_prefix in " + appConfig.ConfigFile)
+
+	head, _ := gitRepo.Repository.Head()
+	message := fmt.Sprintf("Move configuration files from %s to %s", config.DescribePrefix(oldPrefix), config.DescribePrefix(prefix))
+	if err := commitCommandChanges(gitRepo, staged, message); err != nil {
+		// Once committed, only the push is missing, which the next sync retries
+		if newHead, _ := gitRepo.Repository.Head(); newHead != nil && (head == nil || newHead.Hash() != head.Hash()) {
+			ui.PrintWarning("Committed the move, but failed to push it: " + err.Error())
+			return 0
+		}
+
+		ui.PrintError("Failed to commit: " + err.Error())
+		undoMigrate(appConfig, configManager, gitRepo, oldPrefix, staged)
+		return 1
+	}
+
+	ui.PrintSuccess(message)
+	return 0
+}
+
+// undoMigrate moves the files back to oldPrefix after a failed migration.
+// When the commit failed, gitRepo is set: repo_prefix is restored and the
+// staged paths are staged again, so that no half-staged move is left behind.
+func undoMigrate(appConfig *cli.AppConfig, configManager *config.Manager, gitRepo *git.GitRepo, oldPrefix string, staged []string) {
+	appConfig.RepoPrefix = oldPrefix
+
+	if _, err := configManager.MovePrefix(oldPrefix); err != nil {
+		ui.PrintError(fmt.Sprintf("Failed to move the files back to %s: %v", config.DescribePrefix(oldPrefix), err))
+		return
+	}
+	ui.PrintInfo("Moved the files back to " + config.DescribePrefix(oldPrefix))
+
+	if gitRepo == nil {
+		return
+	}
+
+	if err := cli.SaveRepoPrefix(appConfig); err != nil {
+		ui.PrintError(fmt.Sprintf("Failed to restore repo_prefix to %q in %s: %v", oldPrefix, appConfig.ConfigFile, err))
+	}
+	if err := gitRepo.AddDirs(staged...); err != nil {
+		ui.PrintError("Failed to reset the staged move: " + err.Error())
+	}
+}
@@ -22,6 +22,7 @@ const (
 	TypeError    NotificationType = "ERROR"
 	TypeSuccess  NotificationType = "SUCCESS"
 	TypeFileSync NotificationType = "FILE_SYNC"
+	TypeCritical NotificationType = "CRITICAL"
 )
 
 // NotificationConfig holds configuration for the notification system
@@ -58,8 +59,9 @@ func DefaultConfig() *NotificationConfig {
 
 // Manager handles notifications
 type Manager struct {
-	Config *NotificationConfig
-	logger *log.Logger
+	Config  *NotificationConfig
+	logger  *log.Logger
+	logFile *os.File
 }
 
 // NewManager creates a new notification manager
@@ -69,9 +71,11 @@ func NewManager(config *NotificationConfig) (*Manager, error) {
 	}
 
 	var logger *log.Logger
+	var logFile *os.File
 	if config.EnableFileLogging {
 		// Create log file (append mode)
-		logFile, err := os.OpenFile(config.LogFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		var err error
+		logFile, err = os.OpenFile(config.LogFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open log file: %w", err)
 		}
@@ -83,8 +87,9 @@ func NewManager(config *NotificationConfig) (*Manager, error) {
 	}
 
 	return &Manager{
-		Config: config,
-		logger: logger,
+		Config:  config,
+		logger:  logger,
+		logFile: logFile,
 	}, nil
 }
 
@@ -101,7 +106,7 @@ func (m *Manager) Notify(nType NotificationType, title, message string) {
 		ui.PrintInfo(message)
 	case TypeWarning:
 		ui.PrintWarning(message)
-	case TypeError:
+	case TypeError, TypeCritical:
 		ui.PrintError(message)
 	case TypeSuccess:
 		ui.PrintSuccess(message)
@@ -111,7 +116,12 @@ func (m *Manager) Notify(nType NotificationType, title, message string) {
 
 	// Show desktop notification if enabled
 	if m.Config.EnableDesktopNotifications {
-		m.sendDesktopNotification(title, message)
+		if nType == TypeCritical {
+			// Critical notifications stay on screen until dismissed
+			SendErrorNotification(m.Config.AppName, title, message)
+		} else {
+			m.sendDesktopNotification(title, message)
+		}
 	}
 }
 
@@ -141,6 +151,11 @@ func (m *Manager) Close() {
 		// Log shutdown
 		m.logger.Printf("[%s] Config handler notification system stopped", TypeInfo)
 	}
+
+	if m.logFile != nil {
+		m.logFile.Close()
+		m.logFile, m.logger = nil, nil
+	}
 }
 
 // NotifyFileChange sends a notification about a file change
@@ -184,6 +199,17 @@ func (m *Manager) SyncError(message string) {
 	m.Notify(TypeError, "Sync Error", message)
 }
 
+// StormDetected sends a warning when a burst of changes is held back to be
+// committed at once
+func (m *Manager) StormDetected(message string) {
+	m.Notify(TypeWarning, "Burst of Changes", message)
+}
+
+// SyncPaused sends a critical notification when syncing is paused by the safety checks
+func (m *Manager) SyncPaused(message string) {
+	m.Notify(TypeCritical, "Sync Paused", message)
+}
+
 // SyncSuccess sends a notification about a successful sync
 func (m *Manager) SyncSuccess(message string) {
 	m.Notify(TypeSuccess, "Sync Complete", message)
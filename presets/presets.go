@@ -0,0 +1,204 @@
+// Package presets provides include and exclude patterns for common applications
+package presets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Preset lists what to sync for an application and which volatile paths
+// inside it to leave out. Presets with only exclude patterns filter out noisy
+// applications without restricting what else is synced.
+type Preset struct {
+	Name        string   `mapstructure:"name" yaml:"name"`
+	Description string   `mapstructure:"description" yaml:"description"`
+	Include     []string `mapstructure:"include" yaml:"include"`
+	Exclude     []string `mapstructure:"exclude" yaml:"exclude"`
+}
+
+// builtin is the catalog shipped with the config handler. Paths are relative
+// to the config directory (usually ~/.config).
+var builtin = []Preset{
+	{
+		Name:        "alacritty",
+		Description: "Alacritty terminal",
+		Include:     []string{"alacritty"},
+	},
+	{
+		Name:        "btop",
+		Description: "btop resource monitor",
+		Include:     []string{"btop"},
+		Exclude:     []string{"btop/btop.log"},
+	},
+	{
+		Name:        "dunst",
+		Description: "Dunst notification daemon",
+		Include:     []string{"dunst"},
+	},
+	{
+		Name:        "fish",
+		Description: "Fish shell, without universal variables",
+		Include:     []string{"fish"},
+		Exclude:     []string{"fish/fish_variables", "fish/fish_history"},
+	},
+	{
+		Name:        "git",
+		Description: "Git global config and ignore file",
+		Include:     []string{"git"},
+	},
+	{
+		Name:        "gtk",
+		Description: "GTK 3 and 4 settings",
+		Include:     []string{"gtk-3.0", "gtk-4.0"},
+	},
+	{
+		Name:        "hyprland",
+		Description: "Hyprland compositor, hyprlock and hypridle",
+		Include:     []string{"hypr"},
+	},
+	{
+		Name:        "i3",
+		Description: "i3 window manager and i3status",
+		Include:     []string{"i3", "i3status"},
+	},
+	{
+		Name:        "jetbrains",
+		Description: "JetBrains IDE options only, without caches, plugins or machine-specific state",
+		Include:     []string{"JetBrains/*/options", "JetBrains/*/keymaps", "JetBrains/*/codestyles", "JetBrains/*/templates"},
+		Exclude: []string{
+			"JetBrains/*/options/{recentProjects,recentSolutions,window.state,actionSummary,updates,usage.statistics,features.usage.statistics,jdk.table,other}.xml",
+		},
+	},
+	{
+		Name:        "kitty",
+		Description: "kitty terminal",
+		Include:     []string{"kitty"},
+	},
+	{
+		Name:        "nvim",
+		Description: "Neovim, without netrw history and compiled spell files",
+		Include:     []string{"nvim"},
+		Exclude:     []string{"nvim/.netrwhist", "nvim/spell/*.spl"},
+	},
+	{
+		Name:        "picom",
+		Description: "picom compositor",
+		Include:     []string{"picom", "picom.conf"},
+	},
+	{
+		Name:        "polybar",
+		Description: "Polybar status bar",
+		Include:     []string{"polybar"},
+	},
+	{
+		Name:        "rofi",
+		Description: "Rofi launcher",
+		Include:     []string{"rofi"},
+	},
+	{
+		Name:        "starship",
+		Description: "Starship prompt",
+		Include:     []string{"starship.toml"},
+	},
+	{
+		Name:        "sway",
+		Description: "Sway compositor and swaylock",
+		Include:     []string{"sway", "swaylock"},
+	},
+	{
+		Name:        "tmux",
+		Description: "tmux, without plugins installed by tpm",
+		Include:     []string{"tmux"},
+		Exclude:     []string{"tmux/plugins", "tmux/resurrect"},
+	},
+	{
+		Name:        "vscode",
+		Description: "VS Code user settings, keybindings and snippets only",
+		Include:     []string{"Code/User/settings.json", "Code/User/keybindings.json", "Code/User/snippets"},
+	},
+	{
+		Name:        "waybar",
+		Description: "Waybar status bar",
+		Include:     []string{"waybar"},
+	},
+
+	// Exclude-only presets for applications that keep state in ~/.config
+	{
+		Name:        "browsers",
+		Description: "Exclude browser profiles",
+		Exclude:     []string{"BraveSoftware", "google-chrome", "google-chrome-for-testing", "chromium", "Chromium", "vivaldi", "microsoft-edge", "mozilla"},
+	},
+	{
+		Name:        "electron",
+		Description: "Exclude Electron apps, whose directories are mostly caches",
+		Exclude: []string{
+			"Electron", "Discord", "discord", "WebCord", "Slack", "Teams", "Postman", "MongoDB Compass",
+			"GitKraken", "obsidian", "Signal", "Element", "spotify",
+		},
+	},
+	{
+		Name:        "caches",
+		Description: "Exclude caches and package manager state",
+		Exclude: []string{
+			"cache", "Cache", "caches", "CachedData", "**/cache", "**/Cache", "**/CachedData", "**/GPUCache",
+			"node_modules", "**/node_modules", "npm", "yarn", "pnpm", "configstore", "go",
+		},
+	},
+}
+
+// Catalog holds the built-in presets and any defined in the configuration
+type Catalog struct {
+	presets map[string]Preset
+}
+
+// NewCatalog creates a catalog of the built-in presets extended with custom
+// ones. A custom preset replaces a built-in preset of the same name.
+func NewCatalog(custom []Preset) *Catalog {
+	c := &Catalog{presets: make(map[string]Preset, len(builtin)+len(custom))}
+	for _, preset := range builtin {
+		c.presets[preset.Name] = preset
+	}
+	for _, preset := range custom {
+		c.presets[preset.Name] = preset
+	}
+	return c
+}
+
+// Get returns the preset with the given name
+func (c *Catalog) Get(name string) (Preset, bool) {
+	preset, ok := c.presets[name]
+	return preset, ok
+}
+
+// All returns every preset sorted by name
+func (c *Catalog) All() []Preset {
+	all := make([]Preset, 0, len(c.presets))
+	for _, preset := range c.presets {
+		all = append(all, preset)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// Expand returns the include and exclude patterns of the named presets
+func (c *Catalog) Expand(names []string) ([]string, []string, error) {
+	var include, exclude, unknown []string
+	for _, name := range names {
+		preset, ok := c.presets[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		include = append(include, preset.Include...)
+		exclude = append(exclude, preset.Exclude...)
+	}
+
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("unknown presets: %s (run the presets command to list them)", strings.Join(unknown, ", "))
+	}
+
+	return include, exclude, nil
+}
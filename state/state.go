@@ -0,0 +1,277 @@
+// Package state persists runtime state of the config handler between runs
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TrashEntry is a deleted file waiting for its grace period to expire
+type TrashEntry struct {
+	Path      string    `json:"path"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// WatcherStatus describes how a running instance watches one root
+type WatcherStatus struct {
+	Root      string    `json:"root"`
+	PID       int       `json:"pid"`
+	Backend   string    `json:"backend"`
+	Watched   int       `json:"watched"` // Directories watched with inotify
+	Polled    int       `json:"polled"`  // Directories scanned by polling
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SyncPause records that a running instance stopped syncing a root because
+// a batch of changes failed the safety checks
+type SyncPause struct {
+	Root     string    `json:"root"`
+	PID      int       `json:"pid"`
+	Reason   string    `json:"reason"`
+	PausedAt time.Time `json:"paused_at"`
+}
+
+// data is the on-disk layout of the state file
+type data struct {
+	Trash    []TrashEntry    `json:"trash"`
+	Watchers []WatcherStatus `json:"watchers,omitempty"`
+	Pauses   []SyncPause     `json:"pauses,omitempty"`
+}
+
+// Store reads and writes the state file. Every operation reloads the file so
+// that separate processes (the daemon and one-off commands) see each other's changes.
+type Store struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewStore creates a state store backed by the given file
+func NewStore(path string) *Store {
+	return &Store{Path: path}
+}
+
+// load reads the state file, returning empty state if it doesn't exist yet
+func (s *Store) load() (*data, error) {
+	d := &data{}
+
+	content, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return d, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(content, d); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	return d, nil
+}
+
+// save writes the state file through a temporary file so it is never half-written
+func (s *Store) save(d *data) error {
+	content, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tempPath := s.Path + ".tmp"
+	if err := os.WriteFile(tempPath, content, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, s.Path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
+	return nil
+}
+
+// update loads the state, applies fn and saves the result
+func (s *Store) update(fn func(d *data)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	fn(d)
+	return s.save(d)
+}
+
+// AddToTrash queues paths for deletion. Paths already in the trash keep their
+// original deletion time.
+func (s *Store) AddToTrash(paths []string, deletedAt time.Time) error {
+	return s.update(func(d *data) {
+		existing := make(map[string]bool, len(d.Trash))
+		for _, entry := range d.Trash {
+			existing[entry.Path] = true
+		}
+
+		for _, path := range paths {
+			if !existing[path] {
+				d.Trash = append(d.Trash, TrashEntry{Path: path, DeletedAt: deletedAt})
+				existing[path] = true
+			}
+		}
+	})
+}
+
+// RemoveFromTrash drops paths from the trash
+func (s *Store) RemoveFromTrash(paths []string) error {
+	remove := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		remove[path] = true
+	}
+
+	return s.update(func(d *data) {
+		kept := d.Trash[:0]
+		for _, entry := range d.Trash {
+			if !remove[entry.Path] {
+				kept = append(kept, entry)
+			}
+		}
+		d.Trash = kept
+	})
+}
+
+// TrashEntries returns all entries in the trash sorted by path
+func (s *Store) TrashEntries() ([]TrashEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(d.Trash, func(i, j int) bool {
+		return d.Trash[i].Path < d.Trash[j].Path
+	})
+	return d.Trash, nil
+}
+
+// ExpiredTrash returns the entries whose grace period has elapsed
+func (s *Store) ExpiredTrash(gracePeriod time.Duration, now time.Time) ([]TrashEntry, error) {
+	entries, err := s.TrashEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []TrashEntry
+	for _, entry := range entries {
+		if now.Sub(entry.DeletedAt) >= gracePeriod {
+			expired = append(expired, entry)
+		}
+	}
+
+	return expired, nil
+}
+
+// RenameInTrash changes the paths of trashed entries, keeping their deletion time
+func (s *Store) RenameInTrash(renames map[string]string) error {
+	return s.update(func(d *data) {
+		for i, entry := range d.Trash {
+			if path, ok := renames[entry.Path]; ok {
+				d.Trash[i].Path = path
+			}
+		}
+	})
+}
+
+// SetWatcherStatus records how a root is watched, replacing its previous status
+func (s *Store) SetWatcherStatus(status WatcherStatus) error {
+	return s.update(func(d *data) {
+		for i, existing := range d.Watchers {
+			if existing.Root == status.Root {
+				d.Watchers[i] = status
+				return
+			}
+		}
+		d.Watchers = append(d.Watchers, status)
+	})
+}
+
+// ClearWatcherStatus drops the status of a root that is no longer watched
+func (s *Store) ClearWatcherStatus(root string) error {
+	return s.update(func(d *data) {
+		kept := d.Watchers[:0]
+		for _, status := range d.Watchers {
+			if status.Root != root {
+				kept = append(kept, status)
+			}
+		}
+		d.Watchers = kept
+	})
+}
+
+// WatcherStatuses returns the recorded watcher statuses sorted by root
+func (s *Store) WatcherStatuses() ([]WatcherStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(d.Watchers, func(i, j int) bool {
+		return d.Watchers[i].Root < d.Watchers[j].Root
+	})
+	return d.Watchers, nil
+}
+
+// SetSyncPause records that syncing a root is paused, replacing its previous pause
+func (s *Store) SetSyncPause(pause SyncPause) error {
+	return s.update(func(d *data) {
+		for i, existing := range d.Pauses {
+			if existing.Root == pause.Root {
+				d.Pauses[i] = pause
+				return
+			}
+		}
+		d.Pauses = append(d.Pauses, pause)
+	})
+}
+
+// ClearSyncPause drops the pause of a root, which resumes syncing it
+func (s *Store) ClearSyncPause(root string) error {
+	return s.update(func(d *data) {
+		kept := d.Pauses[:0]
+		for _, pause := range d.Pauses {
+			if pause.Root != root {
+				kept = append(kept, pause)
+			}
+		}
+		d.Pauses = kept
+	})
+}
+
+// SyncPauseFor returns the pause recorded for a root, or nil if it isn't paused
+func (s *Store) SyncPauseFor(root string) (*SyncPause, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pause := range d.Pauses {
+		if pause.Root == root {
+			return &pause, nil
+		}
+	}
+	return nil, nil
+}
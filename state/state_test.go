@@ -0,0 +1,77 @@
+package state
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Trashing a path again must not restart its grace period, or a file deleted
+// over and over would never expire
+func TestExpiredTrashKeepsOriginalDeletionTime(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	grace := time.Hour
+
+	tests := []struct {
+		name    string
+		batches map[time.Duration][]string // Offset from start to the paths trashed then
+		now     time.Duration
+		want    []string
+	}{
+		{
+			name:    "within the grace period",
+			batches: map[time.Duration][]string{0: {"a.conf"}},
+			now:     30 * time.Minute,
+			want:    nil,
+		},
+		{
+			name:    "grace period elapsed",
+			batches: map[time.Duration][]string{0: {"a.conf"}},
+			now:     time.Hour,
+			want:    []string{"a.conf"},
+		},
+		{
+			name:    "trashed again later",
+			batches: map[time.Duration][]string{0: {"a.conf"}, 50 * time.Minute: {"a.conf"}},
+			now:     time.Hour,
+			want:    []string{"a.conf"},
+		},
+		{
+			name:    "only the older entry expired",
+			batches: map[time.Duration][]string{0: {"a.conf"}, 40 * time.Minute: {"a.conf", "b.conf"}},
+			now:     time.Hour,
+			want:    []string{"a.conf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore(filepath.Join(t.TempDir(), "state.json"))
+
+			offsets := make([]time.Duration, 0, len(tt.batches))
+			for offset := range tt.batches {
+				offsets = append(offsets, offset)
+			}
+			slices.Sort(offsets)
+			for _, offset := range offsets {
+				if err := store.AddToTrash(tt.batches[offset], start.Add(offset)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expired, err := store.ExpiredTrash(grace, start.Add(tt.now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, entry := range expired {
+				got = append(got, entry.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
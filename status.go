@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"config_handler/cli"
+	"config_handler/config"
+	"config_handler/ui"
+)
+
+// runStatusCommand reports how a running instance watches each root and how
+// much of the inotify watch budget is in use
+func runStatusCommand(appConfig *cli.AppConfig) int {
+	configManagers, err := newConfigManagers(appConfig, nil, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	ui.PrintSection("Watcher")
+	ui.PrintInfo(fmt.Sprintf("Backend: %s (poll interval %s)", appConfig.WatcherBackend, appConfig.PollInterval))
+
+	limit, inUse, known := config.InotifyWatches()
+	available := 0
+	if known {
+		reserve := config.InotifyReserve(limit)
+		available = max(limit-reserve-inUse, 0)
+		ui.PrintInfo(fmt.Sprintf("inotify watches: %d of %d in use by your processes, %d kept for other programs, %d available",
+			inUse, limit, reserve, available))
+	} else {
+		ui.PrintInfo("inotify watches: the limit isn't known on this system")
+	}
+
+	for _, configManager := range configManagers {
+		ui.PrintSection(configManager.ConfigDir)
+
+		needed, err := configManager.DirsToWatch()
+		if err != nil {
+			ui.PrintError("Failed to scan the config directory: " + err.Error())
+			return 1
+		}
+		ui.PrintInfo(fmt.Sprintf("Directories to watch: %d", needed))
+
+		pause, err := configManager.SyncPause()
+		if err != nil {
+			ui.PrintError("Failed to read the pause: " + err.Error())
+			return 1
+		}
+		if pause != nil && processRunning(pause.PID) {
+			ui.PrintWarning(fmt.Sprintf("Syncing paused since %s: %s (run resume to sync anyway)", pause.PausedAt.Format(time.DateTime), pause.Reason))
+		}
+
+		status, err := configManager.WatcherStatus()
+		if err != nil {
+			ui.PrintError("Failed to read the watcher status: " + err.Error())
+			return 1
+		}
+
+		if status == nil || !processRunning(status.PID) {
+			ui.PrintInfo("Not being watched")
+			if known && needed > available {
+				ui.PrintWarning(fmt.Sprintf("Only %d inotify watches are available; %d directories would be polled", available, needed-available))
+			}
+			continue
+		}
+
+		ui.PrintInfo(fmt.Sprintf("Watched by process %d with %s: %d directories with inotify, %d polled (as of %s)",
+			status.PID, status.Backend, status.Watched, status.Polled, status.UpdatedAt.Format(time.DateTime)))
+		if status.Polled > 0 && status.Backend != config.BackendPoll {
+			ui.PrintWarning("Raise fs.inotify.max_user_watches to watch every directory with inotify")
+		}
+	}
+
+	return 0
+}
+
+// processRunning reports whether the process with the given ID still exists
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// runResumeCommand clears the pauses recorded by running instances, which then
+// sync the changes they held back
+func runResumeCommand(appConfig *cli.AppConfig) int {
+	configManagers, err := newConfigManagers(appConfig, nil, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	resumed := 0
+	for _, configManager := range configManagers {
+		pause, err := configManager.SyncPause()
+		if err != nil {
+			ui.PrintError("Failed to read the pause: " + err.Error())
+			return 1
+		}
+		if pause == nil {
+			continue
+		}
+
+		if err := configManager.Resume(); err != nil {
+			ui.PrintError("Failed to resume syncing: " + err.Error())
+			return 1
+		}
+		if !processRunning(pause.PID) {
+			ui.PrintInfo(fmt.Sprintf("Cleared the pause of %s; the process that paused it is no longer running", configManager.ConfigDir))
+			continue
+		}
+
+		resumed++
+		ui.PrintSuccess(fmt.Sprintf("Resumed syncing %s (paused: %s)", configManager.ConfigDir, pause.Reason))
+	}
+
+	if resumed == 0 {
+		ui.PrintInfo("No running instance has paused syncing")
+	} else {
+		ui.PrintInfo(fmt.Sprintf("The held back changes are synced within %s", appConfig.MaintenanceInterval))
+	}
+	return 0
+}
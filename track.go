@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"config_handler/cli"
+	"config_handler/config"
+	"config_handler/env"
+	"config_handler/git"
+	"config_handler/ui"
+)
+
+// initRepository initializes or opens the repository for the configured mode
+func initRepository(appConfig *cli.AppConfig) (*git.GitRepo, error) {
+	if appConfig.InPlace() {
+		return git.InitOrOpenInPlaceRepo(appConfig.RepoDir, appConfig.ConfigDir)
+	}
+	return git.InitOrOpenRepo(appConfig.RepoDir)
+}
+
+// openRepository opens the repository for a command, with the remote and
+// credentials from .env when they are set
+func openRepository(appConfig *cli.AppConfig) (*git.GitRepo, error) {
+	gitRepo, err := initRepository(appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	envConfig, err := env.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if envConfig.GithubRepoURL != "" {
+		if err := gitRepo.SetRemote(envConfig.GithubRepoURL); err != nil {
+			return nil, err
+		}
+	}
+	if envConfig.GithubUsername != "" && envConfig.GithubToken != "" {
+		gitRepo.SetCredentials(envConfig.GithubUsername, envConfig.GithubToken)
+	}
+
+	return gitRepo, nil
+}
+
+// commitCommandChanges commits the changes a command made below the given
+// directories of the repository, syncing with the remote when one is
+// configured. Other roots' files are left for their own commits.
+func commitCommandChanges(gitRepo *git.GitRepo, dirs []string, message string) error {
+	if gitRepo.RemoteURL != "" && gitRepo.Auth != nil {
+		return gitRepo.SyncDirsWithRemote(dirs, message)
+	}
+
+	ui.PrintWarning("No remote configured; committing locally only")
+	if !gitRepo.InPlace() {
+		if err := gitRepo.AddDirs(dirs...); err != nil {
+			return err
+		}
+	}
+
+	err := gitRepo.Commit(message)
+	if err != nil && err.Error() == "no changes to commit" {
+		ui.PrintInfo("No changes to commit")
+		return nil
+	}
+	return err
+}
+
+// runTrackCommand adds paths to the synced set, updating the include and
+// exclude patterns, and syncs them right away
+func runTrackCommand(appConfig *cli.AppConfig, args []string) int {
+	if len(args) == 0 {
+		ui.PrintError("Usage: track <path...>")
+		return 1
+	}
+
+	if !checkConfigDirPaths(appConfig, args) {
+		return 1
+	}
+
+	var relPaths []string
+	for _, path := range args {
+		relPath := configRelPath(appConfig, path)
+		if _, err := os.Lstat(filepath.Join(appConfig.ConfigDir, relPath)); err != nil {
+			ui.PrintError(fmt.Sprintf("Cannot track %s: %v", path, err))
+			return 1
+		}
+
+		pattern := filepath.ToSlash(relPath)
+
+		// Drop an exclude pattern for exactly this path
+		if i := slices.Index(appConfig.ExcludePatterns, pattern); i >= 0 {
+			appConfig.ExcludePatterns = slices.Delete(appConfig.ExcludePatterns, i, i+1)
+		}
+
+		// Without include patterns everything not excluded is already synced
+		if include, _, err := appConfig.Patterns(); err == nil && len(include) > 0 && !slices.Contains(appConfig.IncludePatterns, pattern) {
+			appConfig.IncludePatterns = append(appConfig.IncludePatterns, pattern)
+		}
+
+		relPaths = append(relPaths, relPath)
+	}
+
+	// Make sure the new patterns really include the paths before saving them
+	configManager, err := newConfigManager(appConfig, nil, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	for _, relPath := range relPaths {
+		if decision := configManager.Explain(relPath); !decision.Included {
+			ui.PrintError(fmt.Sprintf("Cannot track %s: it is still excluded (%s)", relPath, decision.Reason))
+			return 1
+		}
+	}
+
+	return applyTracking(appConfig, relPaths, func(configManager *config.Manager, relPath string) ([]string, error) {
+		return configManager.TrackPath(relPath)
+	}, "added", "Track")
+}
+
+// runUntrackCommand removes paths from the synced set and from the
+// repository, keeping the local files
+func runUntrackCommand(appConfig *cli.AppConfig, args []string) int {
+	if len(args) == 0 {
+		ui.PrintError("Usage: untrack <path...>")
+		return 1
+	}
+
+	if !checkConfigDirPaths(appConfig, args) {
+		return 1
+	}
+
+	var relPaths []string
+	for _, path := range args {
+		relPath := configRelPath(appConfig, path)
+		pattern := filepath.ToSlash(relPath)
+
+		// Drop an include pattern for exactly this path, unless it is the last
+		// one: an empty include list would sync everything
+		if i := slices.Index(appConfig.IncludePatterns, pattern); i >= 0 && len(appConfig.IncludePatterns) > 1 {
+			appConfig.IncludePatterns = slices.Delete(appConfig.IncludePatterns, i, i+1)
+		}
+
+		relPaths = append(relPaths, relPath)
+	}
+
+	configManager, err := newConfigManager(appConfig, nil, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	// Exclude paths that other patterns still include
+	for _, relPath := range relPaths {
+		decision := configManager.Explain(relPath)
+		pattern := filepath.ToSlash(relPath)
+		if (decision.Included || decision.Descend) && !slices.Contains(appConfig.ExcludePatterns, pattern) {
+			appConfig.ExcludePatterns = append(appConfig.ExcludePatterns, pattern)
+		}
+	}
+
+	return applyTracking(appConfig, relPaths, func(configManager *config.Manager, relPath string) ([]string, error) {
+		return configManager.UntrackPath(relPath)
+	}, "deleted", "Untrack")
+}
+
+// checkConfigDirPaths reports paths that belong to a further root, whose
+// patterns track and untrack don't edit
+func checkConfigDirPaths(appConfig *cli.AppConfig, paths []string) bool {
+	configManagers, err := newConfigManagers(appConfig, nil, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return false
+	}
+
+	for _, path := range paths {
+		if configManager, _ := managerForPath(appConfig, configManagers, path); configManager != configManagers[0] {
+			ui.PrintError(fmt.Sprintf("%s belongs to the root %s; edit its include and exclude patterns in %s",
+				path, configManager.ConfigDir, appConfig.ConfigFile))
+			return false
+		}
+	}
+	return true
+}
+
+// applyTracking saves the updated patterns, runs update on each path and
+// commits the result
+func applyTracking(appConfig *cli.AppConfig, relPaths []string, update func(*config.Manager, string) ([]string, error), operation, verb string) int {
+	if err := cli.SavePatterns(appConfig); err != nil {
+		ui.PrintError("Failed to save patterns: " + err.Error())
+		return 1
+	}
+	ui.PrintSuccess("Updated patterns in " + appConfig.ConfigFile)
+
+	gitRepo, err := openRepository(appConfig)
+	if err != nil {
+		ui.PrintError("Failed to open repository: " + err.Error())
+		return 1
+	}
+
+	configManager, err := newConfigManager(appConfig, gitRepo, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	// Keep a running instance from committing the half-updated root
+	defer configManager.LockWorkTree()()
+
+	total := 0
+	for _, relPath := range relPaths {
+		files, err := update(configManager, relPath)
+		for _, file := range files {
+			ui.PrintFileOperation(operation, file)
+		}
+		total += len(files)
+
+		if err != nil {
+			ui.PrintError(fmt.Sprintf("Failed to %s %s: %v", strings.ToLower(verb), relPath, err))
+			return 1
+		}
+	}
+
+	message := fmt.Sprintf("%s %s (%d files)", verb, strings.Join(relPaths, ", "), total)
+	if verb == "Untrack" {
+		message = fmt.Sprintf("%s %s (%d files removed from the repository, kept locally)", verb, strings.Join(relPaths, ", "), total)
+	}
+
+	if err := commitCommandChanges(gitRepo, []string{configManager.RepoPrefix}, message); err != nil {
+		ui.PrintError("Failed to commit: " + err.Error())
+		return 1
+	}
+
+	ui.PrintSuccess(message)
+	return 0
+}
+
+// runTrackedCommand lists the patterns and the files currently in the repository
+func runTrackedCommand(appConfig *cli.AppConfig) int {
+	gitRepo, err := initRepository(appConfig)
+	if err != nil {
+		ui.PrintError("Failed to open repository: " + err.Error())
+		return 1
+	}
+
+	configManagers, err := newConfigManagers(appConfig, gitRepo, nil)
+	if err != nil {
+		ui.PrintError("Invalid configuration: " + err.Error())
+		return 1
+	}
+
+	var files []string
+	for _, configManager := range configManagers {
+		rootFiles, err := configManager.TrackedFiles()
+		if err != nil {
+			ui.PrintError("Failed to list tracked files: " + err.Error())
+			return 1
+		}
+		for _, file := range rootFiles {
+			files = append(files, commandPath(configManagers, configManager, file))
+		}
+	}
+
+	ui.PrintSection("Patterns")
+	if len(appConfig.Presets) > 0 {
+		ui.PrintInfo("Presets: " + strings.Join(appConfig.Presets, ", "))
+	}
+	if len(appConfig.IncludePatterns) > 0 {
+		ui.PrintInfo("Include: " + strings.Join(appConfig.IncludePatterns, ", "))
+	} else if len(appConfig.Presets) == 0 {
+		ui.PrintInfo("Include: everything")
+	}
+	if len(appConfig.ExcludePatterns) > 0 {
+		ui.PrintInfo("Exclude: " + strings.Join(appConfig.ExcludePatterns, ", "))
+	}
+	for _, root := range appConfig.Roots {
+		ui.PrintInfo(fmt.Sprintf("Root %s → %s/: include %s, exclude %s", root.Source, root.Target,
+			strings.Join(root.Include, ", "), strings.Join(root.Exclude, ", ")))
+	}
+
+	ui.PrintSection(fmt.Sprintf("Tracked Files (%d)", len(files)))
+	for _, file := range files {
+		ui.PrintFileOperation("added", file)
+	}
+
+	return 0
+}
@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"bufio"
 	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -297,6 +300,16 @@ type SelectModel struct {
 	quitting bool
 }
 
+// ChecklistModel represents a multiple-choice prompt
+type ChecklistModel struct {
+	choices   []string
+	checked   []bool
+	cursor    int
+	question  string
+	confirmed bool
+	quitting  bool
+}
+
 // Init initializes the model
 func (m SelectModel) Init() tea.Cmd {
 	return nil
@@ -353,6 +366,88 @@ func (m SelectModel) View() string {
 	return s.String()
 }
 
+// Init initializes the model
+func (m ChecklistModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles user input
+func (m ChecklistModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.choices)-1 {
+				m.cursor++
+			}
+		case " ", "x":
+			m.checked[m.cursor] = !m.checked[m.cursor]
+		case "a":
+			// Check everything, or clear everything if all are checked
+			all := true
+			for _, checked := range m.checked {
+				all = all && checked
+			}
+			for i := range m.checked {
+				m.checked[i] = !all
+			}
+		case "enter":
+			m.confirmed = true
+			m.quitting = true
+			return m, tea.Quit
+		case "ctrl+c", "q", "esc":
+			m.quitting = true
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+// View renders the model
+func (m ChecklistModel) View() string {
+	var s strings.Builder
+
+	if m.quitting {
+		count := 0
+		for _, checked := range m.checked {
+			if checked {
+				count++
+			}
+		}
+		if m.confirmed {
+			s.WriteString(promptStyle.Render("❯ ") + m.question + fmt.Sprintf(": %d selected\n", count))
+		} else {
+			s.WriteString(promptStyle.Render("❯ ") + m.question + ": cancelled\n")
+		}
+		return s.String()
+	}
+
+	s.WriteString(promptStyle.Render("❯ ") + m.question + ":\n\n")
+
+	for i, choice := range m.choices {
+		cursor := " "
+		if m.cursor == i {
+			cursor = ">"
+			choice = highlightStyle.Render(choice)
+		} else {
+			choice = infoStyle.Render(choice)
+		}
+
+		box := "[ ]"
+		if m.checked[i] {
+			box = addedStyle.Render("[x]")
+		}
+		s.WriteString(fmt.Sprintf("  %s %s %s\n", cursor, box, choice))
+	}
+
+	s.WriteString("\n(Use arrow keys to navigate, Space to toggle, a to toggle all, Enter to confirm, q to cancel)")
+	return s.String()
+}
+
 // ---------- Public UI Functions ----------
 
 // PrintLogo prints the application logo
@@ -420,6 +515,10 @@ func PrintFileOperation(operation, path string) {
 		fmt.Println(modifiedStyle.Render("  [~] " + path))
 	case "deleted":
 		fmt.Println(deletedStyle.Render("  [-] " + path))
+	case "renamed":
+		fmt.Println(modifiedStyle.Render("  [>] " + path))
+	case "trashed":
+		fmt.Println(modifiedStyle.Render("  [x] " + path))
 	default:
 		fmt.Println("  [?] " + path)
 	}
@@ -436,6 +535,7 @@ func FormatCommitMessage(message string) string {
 	message = strings.ReplaceAll(message, "added:", addedStyle.Render("added:"))
 	message = strings.ReplaceAll(message, "modified:", modifiedStyle.Render("modified:"))
 	message = strings.ReplaceAll(message, "deleted:", deletedStyle.Render("deleted:"))
+	message = strings.ReplaceAll(message, "renamed:", modifiedStyle.Render("renamed:"))
 
 	return message
 }
@@ -525,6 +625,45 @@ func PromptSelect(prompt string, choices []string, defaultIndex int) string {
 	return choices[defaultIndex]
 }
 
+// PromptChecklist prompts the user to check any number of choices, starting
+// from the given defaults. It returns false if the user cancelled.
+func PromptChecklist(prompt string, choices []string, defaults []bool) ([]bool, bool) {
+	checked := make([]bool, len(choices))
+	copy(checked, defaults)
+
+	p := ChecklistModel{
+		question: prompt,
+		choices:  choices,
+		checked:  checked,
+	}
+
+	m, err := tea.NewProgram(p).Run()
+	if err != nil {
+		// Fall back to a numbered list if TUI fails
+		fmt.Println(promptStyle.Render("❯ " + prompt + ":"))
+		for i, choice := range choices {
+			box := "[ ]"
+			if checked[i] {
+				box = "[x]"
+			}
+			fmt.Printf("  %d. %s %s\n", i+1, box, choice)
+		}
+		fmt.Print("Enter numbers to toggle (space-separated), or press Enter to accept: ")
+
+		reader := bufio.NewReader(os.Stdin)
+		input, _ := reader.ReadString('\n')
+		for _, field := range strings.Fields(input) {
+			if n, err := strconv.Atoi(field); err == nil && n > 0 && n <= len(choices) {
+				checked[n-1] = !checked[n-1]
+			}
+		}
+		return checked, true
+	}
+
+	model, _ := m.(ChecklistModel)
+	return model.checked, model.confirmed
+}
+
 // ExecuteCommand runs a shell command and returns its output
 func ExecuteCommand(command string, args ...string) (string, error) {
 	PrintInfo(fmt.Sprintf("Executing: %s %s", command, strings.Join(args, " ")))
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	"config_handler/cli"
+	"config_handler/env"
+	"config_handler/ui"
+)
+
+// validateConfig checks the configuration and reports include patterns that
+// match nothing in their root
+func validateConfig(appConfig *cli.AppConfig) []cli.Problem {
+	problems := cli.Validate(appConfig)
+	if cli.HasErrors(problems) {
+		return problems
+	}
+
+	configManagers, err := newConfigManagers(appConfig, nil, nil)
+	if err != nil {
+		return append(problems, cli.Problem{Setting: "config", Message: err.Error()})
+	}
+
+	for i, configManager := range configManagers {
+		setting, includeSetting := "config_dir", "include"
+		if i > 0 {
+			setting = fmt.Sprintf("roots[%d]", i-1)
+			includeSetting = setting + ".include"
+		}
+
+		unmatched, err := configManager.UnmatchedIncludes()
+		if err != nil {
+			return append(problems, cli.Problem{Setting: setting, Message: "failed to scan: " + err.Error()})
+		}
+
+		for _, pattern := range unmatched {
+			problems = append(problems, cli.Problem{
+				Setting: includeSetting,
+				Message: fmt.Sprintf("pattern %q doesn't match any synced path (run explain on the expected path to see why)", pattern),
+				Warning: true,
+			})
+		}
+	}
+
+	return problems
+}
+
+// printProblems prints configuration problems, errors before warnings
+func printProblems(problems []cli.Problem) {
+	for _, problem := range problems {
+		if !problem.Warning {
+			ui.PrintError(problem.String())
+		}
+	}
+	for _, problem := range problems {
+		if problem.Warning {
+			ui.PrintWarning(problem.String())
+		}
+	}
+}
+
+// runValidateCommand checks the configuration and the remote URL, exiting
+// non-zero if anything, even a warning, was found
+func runValidateCommand(appConfig *cli.AppConfig) int {
+	problems := validateConfig(appConfig)
+
+	envConfig, err := env.LoadConfig()
+	if err != nil {
+		problems = append(problems, cli.Problem{Setting: "remote", Message: "could not load credentials: " + err.Error()})
+	} else if envConfig.GithubRepoURL == "" {
+		problems = append(problems, cli.Problem{Setting: "remote", Message: "no repository URL configured (set " + env.GithubURLKey + " in .env)"})
+	} else {
+		problems = append(problems, cli.ValidateRemote(envConfig.GithubRepoURL)...)
+	}
+
+	if len(problems) > 0 {
+		printProblems(problems)
+		ui.PrintError(fmt.Sprintf("Found %d problems in the configuration", len(problems)))
+		return 1
+	}
+
+	ui.PrintSuccess("Configuration is valid")
+	return 0
+}